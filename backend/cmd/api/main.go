@@ -35,6 +35,16 @@ func main() {
 
 	api := httpapi.NewServer(cfg, pool, logger)
 
+	go api.RunEventBroker(ctx)
+	go api.RunTrashPurge(ctx)
+
+	queueCtx, stopQueue := context.WithCancel(ctx)
+	queueDone := make(chan struct{})
+	go func() {
+		api.RunQueue(queueCtx)
+		close(queueDone)
+	}()
+
 	srv := &http.Server{
 		Addr:              cfg.HTTPAddr,
 		Handler:           api.Router(),
@@ -54,6 +64,13 @@ func main() {
 
 	ctxShutdown, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	// Stop the queue first so in-flight runs are requeued for other replicas.
+	stopQueue()
+	select {
+	case <-queueDone:
+	case <-ctxShutdown.Done():
+		logger.Warn().Msg("run queue did not stop in time")
+	}
 	_ = srv.Shutdown(ctxShutdown)
 	logger.Info().Msg("shutdown")
 }
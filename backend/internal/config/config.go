@@ -1,14 +1,11 @@
 package config
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
@@ -24,15 +21,21 @@ type Config struct {
 
 	OpenRouterAPIKey  string
 	OpenRouterBaseURL string
-	OpenRouterModels  []string
 	OpenRouterReasoning       bool
 	OpenRouterReasoningEffort string
 	OpenRouterRetries    int
 	OpenRouterRetryDelay time.Duration
 
+	Providers []ProviderConfig
+	Models    []ModelConfig
+
 	SearxNGBaseURL string
 	SearchProvider string
 
+	SearchMultiProviders []string
+	SearchMultiWeights   map[string]float64
+	SearchMultiTimeout   time.Duration
+
 	PipelineTimeout     time.Duration
 	SearchTimeout       time.Duration
 	FetchTimeout        time.Duration
@@ -42,6 +45,36 @@ type Config struct {
 	SnippetMaxPerSource int
 	PageCacheTTL        time.Duration
 	ChatHistoryLimit    int
+	ChatAutoTitle       bool
+	ChatTitleModel      string
+
+	ContextDefaultTokens int
+	ContextReserveTokens int
+
+	FetchAllowHosts   []string
+	FetchDenyHosts    []string
+	FetchMaxRedirects int
+	FetchConcurrency  int
+	FetchPerHost      int
+
+	RunCancelPollInterval time.Duration
+	RunWorkers            int
+	RunQueuePollInterval  time.Duration
+	RunHeartbeatInterval  time.Duration
+	RunStaleAfter         time.Duration
+	RunMaxAttempts        int
+
+	EventBroker string
+
+	QuotaConcurrentRuns int
+	QuotaRunsPerHour    int
+	QuotaDailyTokens    int
+	QuotaDailyCost      float64
+	RunMaxTokens        int
+	RunMaxCost          float64
+
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
 
 	SerperAPIKey  string
 	SerperBaseURL string
@@ -50,12 +83,6 @@ type Config struct {
 	SerperGL      string
 }
 
-type fileConfig struct {
-	OpenRouter struct {
-		Models []string `yaml:"models"`
-	} `yaml:"openrouter"`
-}
-
 func LoadFromEnv() (Config, error) {
 	c := Config{}
 
@@ -86,11 +113,6 @@ func LoadFromEnv() (Config, error) {
 
 	c.OpenRouterAPIKey = getenv("OPENROUTER_API_KEY", "")
 	c.OpenRouterBaseURL = getenv("OPENROUTER_BASE_URL", "https://openrouter.ai/api/v1")
-	models, err := loadModelsFromFile()
-	if err != nil {
-		return Config{}, err
-	}
-	c.OpenRouterModels = models
 	c.OpenRouterReasoning = strings.EqualFold(getenv("OPENROUTER_REASONING", "false"), "true")
 	c.OpenRouterReasoningEffort = strings.TrimSpace(getenv("OPENROUTER_REASONING_EFFORT", "medium"))
 	if c.OpenRouterRetries, err = parseIntEnv("OPENROUTER_RETRIES", 2); err != nil {
@@ -102,6 +124,10 @@ func LoadFromEnv() (Config, error) {
 
 	c.SearxNGBaseURL = getenv("SEARXNG_BASE_URL", "http://searxng:8080")
 	c.SearchProvider = strings.ToLower(getenv("SEARCH_PROVIDER", "searxng"))
+	c.SearchMultiProviders = splitList(getenv("SEARCH_MULTI_PROVIDERS", "searxng,serper"))
+	if c.SearchMultiWeights, err = parseWeightsEnv("SEARCH_MULTI_WEIGHTS"); err != nil {
+		return Config{}, err
+	}
 
 	if c.PipelineTimeout, err = parseDurationEnv("PIPELINE_TIMEOUT", "120s"); err != nil {
 		return Config{}, err
@@ -112,12 +138,37 @@ func LoadFromEnv() (Config, error) {
 	if c.FetchTimeout, err = parseDurationEnv("FETCH_TIMEOUT", "20s"); err != nil {
 		return Config{}, err
 	}
+	if c.SearchMultiTimeout, err = parseDurationEnv("SEARCH_MULTI_TIMEOUT", c.SearchTimeout.String()); err != nil {
+		return Config{}, err
+	}
 	if c.OpenRouterTimeout, err = parseDurationEnv("OPENROUTER_TIMEOUT", "60s"); err != nil {
 		return Config{}, err
 	}
 	if c.PageCacheTTL, err = parseDurationEnv("PAGE_CACHE_TTL", "24h"); err != nil {
 		return Config{}, err
 	}
+	if c.RunCancelPollInterval, err = parseDurationEnv("RUN_CANCEL_POLL_INTERVAL", "2s"); err != nil {
+		return Config{}, err
+	}
+	c.EventBroker = strings.ToLower(getenv("EVENT_BROKER", "memory"))
+	if c.EventBroker != "memory" && c.EventBroker != "postgres" {
+		return Config{}, fmt.Errorf("EVENT_BROKER: unknown broker %q", c.EventBroker)
+	}
+	if c.RunQueuePollInterval, err = parseDurationEnv("RUN_QUEUE_POLL_INTERVAL", "1s"); err != nil {
+		return Config{}, err
+	}
+	if c.RunQueuePollInterval <= 0 {
+		return Config{}, fmt.Errorf("RUN_QUEUE_POLL_INTERVAL must be positive")
+	}
+	if c.RunHeartbeatInterval, err = parseDurationEnv("RUN_HEARTBEAT_INTERVAL", "10s"); err != nil {
+		return Config{}, err
+	}
+	if c.RunHeartbeatInterval <= 0 {
+		return Config{}, fmt.Errorf("RUN_HEARTBEAT_INTERVAL must be positive")
+	}
+	if c.RunStaleAfter, err = parseDurationEnv("RUN_STALE_AFTER", "60s"); err != nil {
+		return Config{}, err
+	}
 
 	if c.SearchMaxQueries, err = parseIntEnv("SEARCH_MAX_QUERIES", 3); err != nil {
 		return Config{}, err
@@ -131,6 +182,55 @@ func LoadFromEnv() (Config, error) {
 	if c.ChatHistoryLimit, err = parseIntEnv("CHAT_HISTORY_LIMIT", 12); err != nil {
 		return Config{}, err
 	}
+	c.ChatAutoTitle = strings.EqualFold(getenv("CHAT_AUTO_TITLE", "true"), "true")
+	c.ChatTitleModel = strings.TrimSpace(getenv("CHAT_TITLE_MODEL", ""))
+	if c.ContextDefaultTokens, err = parseIntEnv("CONTEXT_DEFAULT_TOKENS", 64000); err != nil {
+		return Config{}, err
+	}
+	if c.ContextReserveTokens, err = parseIntEnv("CONTEXT_RESERVE_TOKENS", 8000); err != nil {
+		return Config{}, err
+	}
+	c.FetchAllowHosts = splitList(getenv("FETCH_ALLOW_HOSTS", ""))
+	c.FetchDenyHosts = splitList(getenv("FETCH_DENY_HOSTS", ""))
+	if c.FetchMaxRedirects, err = parseIntEnv("FETCH_MAX_REDIRECTS", 5); err != nil {
+		return Config{}, err
+	}
+	if c.FetchConcurrency, err = parseIntEnv("FETCH_CONCURRENCY", 4); err != nil {
+		return Config{}, err
+	}
+	if c.FetchPerHost, err = parseIntEnv("FETCH_PER_HOST", 2); err != nil {
+		return Config{}, err
+	}
+	if c.RunWorkers, err = parseIntEnv("RUN_WORKERS", 4); err != nil {
+		return Config{}, err
+	}
+	if c.RunMaxAttempts, err = parseIntEnv("RUN_MAX_ATTEMPTS", 2); err != nil {
+		return Config{}, err
+	}
+	if c.TrashRetention, err = parseDurationEnv("TRASH_RETENTION", "720h"); err != nil {
+		return Config{}, err
+	}
+	if c.TrashPurgeInterval, err = parseDurationEnv("TRASH_PURGE_INTERVAL", "1h"); err != nil {
+		return Config{}, err
+	}
+	if c.QuotaConcurrentRuns, err = parseIntEnv("QUOTA_CONCURRENT_RUNS", 3); err != nil {
+		return Config{}, err
+	}
+	if c.QuotaRunsPerHour, err = parseIntEnv("QUOTA_RUNS_PER_HOUR", 60); err != nil {
+		return Config{}, err
+	}
+	if c.QuotaDailyTokens, err = parseIntEnv("QUOTA_DAILY_TOKENS", 0); err != nil {
+		return Config{}, err
+	}
+	if c.QuotaDailyCost, err = parseFloatEnv("QUOTA_DAILY_COST", 0); err != nil {
+		return Config{}, err
+	}
+	if c.RunMaxTokens, err = parseIntEnv("RUN_MAX_TOKENS", 0); err != nil {
+		return Config{}, err
+	}
+	if c.RunMaxCost, err = parseFloatEnv("RUN_MAX_COST", 0); err != nil {
+		return Config{}, err
+	}
 
 	c.SerperAPIKey = strings.TrimSpace(os.Getenv("SERPER_API_KEY"))
 	c.SerperBaseURL = getenv("SERPER_BASE_URL", "https://google.serper.dev")
@@ -140,6 +240,10 @@ func LoadFromEnv() (Config, error) {
 	c.SerperHL = getenv("SERPER_HL", "en")
 	c.SerperGL = getenv("SERPER_GL", "us")
 
+	if err := c.loadModels(); err != nil {
+		return Config{}, err
+	}
+
 	return c, nil
 }
 
@@ -150,49 +254,6 @@ func getenv(k, def string) string {
 	return def
 }
 
-func loadModelsFromFile() ([]string, error) {
-	explicit := strings.TrimSpace(os.Getenv("APP_CONFIG_PATH"))
-	if explicit != "" {
-		return readModels(explicit)
-	}
-
-	candidates := []string{"config.yaml", "../config.yaml"}
-	for _, path := range candidates {
-		models, err := readModels(path)
-		if err == nil {
-			return models, nil
-		}
-		if errors.Is(err, os.ErrNotExist) {
-			continue
-		}
-		return nil, err
-	}
-	return nil, fmt.Errorf("config.yaml not found (set APP_CONFIG_PATH)")
-}
-
-func readModels(path string) ([]string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var fc fileConfig
-	if err := yaml.Unmarshal(data, &fc); err != nil {
-		return nil, fmt.Errorf("parse %s: %w", path, err)
-	}
-	models := make([]string, 0, len(fc.OpenRouter.Models))
-	for _, model := range fc.OpenRouter.Models {
-		model = strings.TrimSpace(model)
-		if model == "" {
-			continue
-		}
-		models = append(models, model)
-	}
-	if len(models) == 0 {
-		return nil, fmt.Errorf("no openrouter.models in %s", path)
-	}
-	return models, nil
-}
-
 func parseDurationEnv(key, def string) (time.Duration, error) {
 	raw := getenv(key, def)
 	parsed, err := time.ParseDuration(raw)
@@ -213,3 +274,43 @@ func parseIntEnv(key string, def int) (int, error) {
 	}
 	return val, nil
 }
+
+func parseFloatEnv(key string, def float64) (float64, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return val, nil
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseWeightsEnv parses "name:weight" pairs, e.g. "searxng:1,serper:1.5".
+func parseWeightsEnv(key string) (map[string]float64, error) {
+	out := map[string]float64{}
+	for _, pair := range splitList(os.Getenv(key)) {
+		name, raw, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected name:weight, got %q", key, pair)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		out[strings.TrimSpace(name)] = weight
+	}
+	return out, nil
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderConfig is an LLM backend speaking the OpenAI chat completions API.
+type ProviderConfig struct {
+	Name            string
+	Type            string
+	BaseURL         string
+	APIKey          string
+	Timeout         time.Duration
+	Retries         int
+	RetryDelay      time.Duration
+	ReasoningEffort string
+}
+
+// ModelConfig is a model offered to users and the provider that serves it.
+type ModelConfig struct {
+	ID            string
+	Provider      string
+	ContextLength int
+	Capabilities  Capabilities
+	// Fallbacks are tried in order when the model's provider fails.
+	Fallbacks []string
+}
+
+type Capabilities struct {
+	Tools     bool `json:"tools"`
+	Reasoning bool `json:"reasoning"`
+	Streaming bool `json:"streaming"`
+}
+
+// Model returns the configuration of a model by id.
+func (c Config) Model(id string) (ModelConfig, bool) {
+	for _, m := range c.Models {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return ModelConfig{}, false
+}
+
+// DefaultModel is the first configured model.
+func (c Config) DefaultModel() string {
+	return c.Models[0].ID
+}
+
+type fileConfig struct {
+	OpenRouter struct {
+		Models []fileModel `yaml:"models"`
+	} `yaml:"openrouter"`
+	Providers []fileProvider      `yaml:"providers"`
+	Fallbacks map[string][]string `yaml:"fallbacks"`
+}
+
+type fileProvider struct {
+	Name            string      `yaml:"name"`
+	Type            string      `yaml:"type"`
+	BaseURL         string      `yaml:"base_url"`
+	APIKeyEnv       string      `yaml:"api_key_env"`
+	Timeout         string      `yaml:"timeout"`
+	Retries         *int        `yaml:"retries"`
+	RetryDelay      string      `yaml:"retry_delay"`
+	ReasoningEffort string      `yaml:"reasoning_effort"`
+	Capabilities    []string    `yaml:"capabilities"`
+	Models          []fileModel `yaml:"models"`
+}
+
+// fileModel is a models entry: either a bare model id or a mapping with the
+// id, its context window in tokens and capabilities overriding the provider's.
+type fileModel struct {
+	ID            string   `yaml:"id"`
+	ContextLength int      `yaml:"context_length"`
+	Capabilities  []string `yaml:"capabilities"`
+}
+
+func (m *fileModel) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		m.ID = node.Value
+		return nil
+	}
+	type plain fileModel
+	return node.Decode((*plain)(m))
+}
+
+// loadModels reads config.yaml and fills Providers and Models. Models under
+// openrouter: belong to an implicit "openrouter" provider configured from the
+// OPENROUTER_* variables; providers: adds further OpenAI-compatible backends,
+// which take their timeout, retries and reasoning effort from the same
+// variables unless set on the entry.
+func (c *Config) loadModels() error {
+	fc, path, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(fc.OpenRouter.Models) > 0 {
+		openrouter := fileProvider{
+			Name:         "openrouter",
+			Type:         "openrouter",
+			Capabilities: []string{"tools", "streaming"},
+			Models:       fc.OpenRouter.Models,
+		}
+		if c.OpenRouterReasoning {
+			openrouter.Capabilities = append(openrouter.Capabilities, "reasoning")
+		}
+		if err := c.addProvider(openrouter, ProviderConfig{
+			Name:            "openrouter",
+			Type:            "openrouter",
+			BaseURL:         c.OpenRouterBaseURL,
+			APIKey:          c.OpenRouterAPIKey,
+			Timeout:         c.OpenRouterTimeout,
+			Retries:         c.OpenRouterRetries,
+			RetryDelay:      c.OpenRouterRetryDelay,
+			ReasoningEffort: c.OpenRouterReasoningEffort,
+		}); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, fp := range fc.Providers {
+		pc := ProviderConfig{
+			Name:            strings.TrimSpace(fp.Name),
+			Type:            strings.ToLower(strings.TrimSpace(fp.Type)),
+			BaseURL:         strings.TrimSpace(fp.BaseURL),
+			Timeout:         c.OpenRouterTimeout,
+			Retries:         c.OpenRouterRetries,
+			RetryDelay:      c.OpenRouterRetryDelay,
+			ReasoningEffort: c.OpenRouterReasoningEffort,
+		}
+		if pc.Name == "" {
+			return fmt.Errorf("%s: provider without name", path)
+		}
+		if pc.Type == "" {
+			pc.Type = "openai"
+		}
+		if pc.BaseURL == "" {
+			return fmt.Errorf("%s: provider %s: base_url is required", path, pc.Name)
+		}
+		if env := strings.TrimSpace(fp.APIKeyEnv); env != "" {
+			pc.APIKey = strings.TrimSpace(os.Getenv(env))
+		}
+		if fp.Timeout != "" {
+			if pc.Timeout, err = time.ParseDuration(fp.Timeout); err != nil {
+				return fmt.Errorf("%s: provider %s: timeout: %w", path, pc.Name, err)
+			}
+		}
+		if fp.Retries != nil {
+			if *fp.Retries < 0 {
+				return fmt.Errorf("%s: provider %s: retries must not be negative", path, pc.Name)
+			}
+			pc.Retries = *fp.Retries
+		}
+		if fp.RetryDelay != "" {
+			if pc.RetryDelay, err = time.ParseDuration(fp.RetryDelay); err != nil {
+				return fmt.Errorf("%s: provider %s: retry_delay: %w", path, pc.Name, err)
+			}
+		}
+		if effort := strings.TrimSpace(fp.ReasoningEffort); effort != "" {
+			pc.ReasoningEffort = effort
+		}
+		if err := c.addProvider(fp, pc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if len(c.Models) == 0 {
+		return fmt.Errorf("no models in %s (openrouter.models or providers)", path)
+	}
+	if err := c.setFallbacks(fc.Fallbacks); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) setFallbacks(chains map[string][]string) error {
+	for model, chain := range chains {
+		idx := slices.IndexFunc(c.Models, func(m ModelConfig) bool { return m.ID == model })
+		if idx < 0 {
+			return fmt.Errorf("fallbacks: unknown model %s", model)
+		}
+		for _, next := range chain {
+			if _, ok := c.Model(next); !ok {
+				return fmt.Errorf("fallbacks: %s: unknown model %s", model, next)
+			}
+			if next == model {
+				return fmt.Errorf("fallbacks: %s falls back to itself", model)
+			}
+		}
+		c.Models[idx].Fallbacks = chain
+	}
+	return nil
+}
+
+func (c *Config) addProvider(fp fileProvider, pc ProviderConfig) error {
+	for _, existing := range c.Providers {
+		if existing.Name == pc.Name {
+			return fmt.Errorf("duplicate provider %s", pc.Name)
+		}
+	}
+	defaults, err := parseCapabilities(fp.Capabilities, Capabilities{Tools: true, Streaming: true})
+	if err != nil {
+		return fmt.Errorf("provider %s: %w", pc.Name, err)
+	}
+	for _, fm := range fp.Models {
+		id := strings.TrimSpace(fm.ID)
+		if id == "" {
+			continue
+		}
+		if _, ok := c.Model(id); ok {
+			return fmt.Errorf("model %s is configured twice", id)
+		}
+		caps, err := parseCapabilities(fm.Capabilities, defaults)
+		if err != nil {
+			return fmt.Errorf("model %s: %w", id, err)
+		}
+		c.Models = append(c.Models, ModelConfig{
+			ID:            id,
+			Provider:      pc.Name,
+			ContextLength: fm.ContextLength,
+			Capabilities:  caps,
+		})
+	}
+	c.Providers = append(c.Providers, pc)
+	return nil
+}
+
+func parseCapabilities(names []string, def Capabilities) (Capabilities, error) {
+	if names == nil {
+		return def, nil
+	}
+	var caps Capabilities
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "tools":
+			caps.Tools = true
+		case "reasoning":
+			caps.Reasoning = true
+		case "streaming":
+			caps.Streaming = true
+		default:
+			return Capabilities{}, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	return caps, nil
+}
+
+func loadFileConfig() (fileConfig, string, error) {
+	explicit := strings.TrimSpace(os.Getenv("APP_CONFIG_PATH"))
+	if explicit != "" {
+		fc, err := readFileConfig(explicit)
+		return fc, explicit, err
+	}
+
+	candidates := []string{"config.yaml", "../config.yaml"}
+	for _, path := range candidates {
+		fc, err := readFileConfig(path)
+		if err == nil {
+			return fc, path, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return fileConfig{}, path, err
+	}
+	return fileConfig{}, "", fmt.Errorf("config.yaml not found (set APP_CONFIG_PATH)")
+}
+
+func readFileConfig(path string) (fileConfig, error) {
+	var fc fileConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fc, err
+	}
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fc, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return fc, nil
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_token_hash_idx ON refresh_tokens(token_hash);
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_tokens_token_hash_idx;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS run_jobs (
+  run_id uuid PRIMARY KEY REFERENCES runs(id) ON DELETE CASCADE,
+  query text NOT NULL,
+  model text NOT NULL,
+  status text NOT NULL DEFAULT 'queued',
+  attempts int NOT NULL DEFAULT 0,
+  locked_by text NULL,
+  locked_at timestamptz NULL,
+  heartbeat_at timestamptz NULL,
+  available_at timestamptz NOT NULL DEFAULT now(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS run_jobs_queued_idx ON run_jobs(available_at, created_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS run_jobs_running_idx ON run_jobs(heartbeat_at) WHERE status = 'running';
+
+-- +goose Down
+DROP TABLE IF EXISTS run_jobs;
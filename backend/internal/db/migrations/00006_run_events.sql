@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN event_seq bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS run_events (
+  run_id uuid NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+  seq bigint NOT NULL,
+  event text NOT NULL,
+  data jsonb NOT NULL DEFAULT '{}'::jsonb,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (run_id, seq)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS run_events;
+ALTER TABLE runs DROP COLUMN IF EXISTS event_seq;
@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS llm_calls (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  -- no FK to runs: usage is accounting and outlives the runs it was spent on
+  run_id uuid NOT NULL,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  model text NOT NULL,
+  provider text NOT NULL DEFAULT '',
+  prompt_tokens integer NOT NULL DEFAULT 0,
+  completion_tokens integer NOT NULL DEFAULT 0,
+  reasoning_tokens integer NOT NULL DEFAULT 0,
+  cached_tokens integer NOT NULL DEFAULT 0,
+  total_tokens integer NOT NULL DEFAULT 0,
+  cost numeric(14,8) NOT NULL DEFAULT 0,
+  estimated boolean NOT NULL DEFAULT false,
+  latency_ms integer NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS llm_calls_run_id_idx ON llm_calls(run_id);
+CREATE INDEX IF NOT EXISTS llm_calls_user_created_idx ON llm_calls(user_id, created_at);
+
+ALTER TABLE runs
+  ADD COLUMN prompt_tokens bigint NOT NULL DEFAULT 0,
+  ADD COLUMN completion_tokens bigint NOT NULL DEFAULT 0,
+  ADD COLUMN reasoning_tokens bigint NOT NULL DEFAULT 0,
+  ADD COLUMN total_tokens bigint NOT NULL DEFAULT 0,
+  ADD COLUMN cost numeric(14,8) NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE runs
+  DROP COLUMN IF EXISTS cost,
+  DROP COLUMN IF EXISTS total_tokens,
+  DROP COLUMN IF EXISTS reasoning_tokens,
+  DROP COLUMN IF EXISTS completion_tokens,
+  DROP COLUMN IF EXISTS prompt_tokens;
+DROP TABLE IF EXISTS llm_calls;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Run starts for the hourly quota. Not tied to runs, so deleting chats does
+-- not give the runs back.
+CREATE TABLE IF NOT EXISTS run_starts (
+  run_id uuid PRIMARY KEY,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  started_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS run_starts_user_started_idx ON run_starts(user_id, started_at);
+
+INSERT INTO run_starts(run_id, user_id, started_at)
+SELECT id, user_id, started_at FROM runs WHERE started_at > now() - interval '1 hour'
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS run_starts;
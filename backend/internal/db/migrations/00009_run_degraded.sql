@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE runs
+  ADD COLUMN degraded boolean NOT NULL DEFAULT false,
+  ADD COLUMN degraded_reason text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS runs_degraded_idx ON runs(started_at) WHERE degraded;
+
+-- +goose Down
+DROP INDEX IF EXISTS runs_degraded_idx;
+ALTER TABLE runs
+  DROP COLUMN IF EXISTS degraded_reason,
+  DROP COLUMN IF EXISTS degraded;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN citations jsonb NOT NULL DEFAULT '[]'::jsonb;
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS citations;
@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN parent_message_id uuid REFERENCES messages(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS messages_parent_message_id_idx ON messages(parent_message_id);
+
+-- the user message a run answers; regenerated runs share one
+ALTER TABLE runs ADD COLUMN user_message_id uuid REFERENCES messages(id) ON DELETE SET NULL;
+
+-- the leaf of the branch shown and fed to the model
+ALTER TABLE chats ADD COLUMN active_message_id uuid REFERENCES messages(id) ON DELETE SET NULL;
+
+-- existing chats become a single branch in message order
+UPDATE messages m
+SET parent_message_id = p.prev_id
+FROM (
+  SELECT id, lag(id) OVER (PARTITION BY chat_id ORDER BY created_at, id) AS prev_id
+  FROM messages
+) p
+WHERE p.id = m.id AND p.prev_id IS NOT NULL;
+
+UPDATE runs r
+SET user_message_id = m.id
+FROM messages m
+WHERE m.run_id = r.id AND m.role = 'user';
+
+UPDATE chats c
+SET active_message_id = (
+  SELECT m.id FROM messages m
+  WHERE m.chat_id = c.id
+  ORDER BY m.created_at DESC, m.id DESC
+  LIMIT 1
+);
+
+-- +goose Down
+ALTER TABLE chats DROP COLUMN IF EXISTS active_message_id;
+ALTER TABLE runs DROP COLUMN IF EXISTS user_message_id;
+DROP INDEX IF EXISTS messages_parent_message_id_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS parent_message_id;
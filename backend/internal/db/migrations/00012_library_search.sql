@@ -0,0 +1,29 @@
+-- +goose Up
+-- Each document is indexed with both the English and the Russian stemmer so
+-- a query matches in either language; queries are parsed the same way.
+ALTER TABLE chats ADD COLUMN search_tsv tsvector GENERATED ALWAYS AS (
+  to_tsvector('english'::regconfig, title) || to_tsvector('russian'::regconfig, title)
+) STORED;
+CREATE INDEX IF NOT EXISTS chats_search_tsv_idx ON chats USING gin(search_tsv);
+
+ALTER TABLE messages ADD COLUMN search_tsv tsvector GENERATED ALWAYS AS (
+  to_tsvector('english'::regconfig, left(content, 100000)) || to_tsvector('russian'::regconfig, left(content, 100000))
+) STORED;
+CREATE INDEX IF NOT EXISTS messages_search_tsv_idx ON messages USING gin(search_tsv);
+
+ALTER TABLE page_cache ADD COLUMN search_tsv tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('english'::regconfig, title) || to_tsvector('russian'::regconfig, title), 'A') ||
+  to_tsvector('english'::regconfig, left(content, 100000)) || to_tsvector('russian'::regconfig, left(content, 100000))
+) STORED;
+CREATE INDEX IF NOT EXISTS page_cache_search_tsv_idx ON page_cache USING gin(search_tsv);
+
+CREATE INDEX IF NOT EXISTS sources_url_idx ON sources(url);
+
+-- +goose Down
+DROP INDEX IF EXISTS sources_url_idx;
+DROP INDEX IF EXISTS page_cache_search_tsv_idx;
+ALTER TABLE page_cache DROP COLUMN IF EXISTS search_tsv;
+DROP INDEX IF EXISTS messages_search_tsv_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_tsv;
+DROP INDEX IF EXISTS chats_search_tsv_idx;
+ALTER TABLE chats DROP COLUMN IF EXISTS search_tsv;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- set once a user renames the chat; automatic titles never overwrite it
+ALTER TABLE chats ADD COLUMN title_edited boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE chats DROP COLUMN IF EXISTS title_edited;
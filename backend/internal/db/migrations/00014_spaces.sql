@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS spaces (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name text NOT NULL,
+  instructions text NOT NULL DEFAULT '',
+  default_model text NOT NULL DEFAULT '',
+  search_provider text NOT NULL DEFAULT '',
+  search_category text NOT NULL DEFAULT '',
+  allow_domains text[] NOT NULL DEFAULT '{}',
+  deny_domains text[] NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS spaces_user_id_idx ON spaces(user_id);
+
+-- deleting a space leaves its chats unfiled
+ALTER TABLE chats ADD COLUMN space_id uuid REFERENCES spaces(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS chats_space_id_updated_at_idx ON chats(space_id, updated_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS chats_space_id_updated_at_idx;
+ALTER TABLE chats DROP COLUMN IF EXISTS space_id;
+DROP TABLE IF EXISTS spaces;
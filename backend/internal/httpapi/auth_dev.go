@@ -2,43 +2,12 @@ package httpapi
 
 import (
 	"context"
-	"fmt"
-	"net/http"
-	"strings"
 
 	"github.com/google/uuid"
 )
 
-// withUser attaches a user to the request context.
-//
-// Dev-mode implementation: if no Authorization header is present, create/use a single
-// user dev@local. This allows UI/agent development before implementing full auth.
-func (s *Server) withUser(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authz := strings.TrimSpace(r.Header.Get("Authorization"))
-		_ = authz // TODO: implement JWT auth
-
-		if s.cfg.Env != "dev" {
-			// In production without auth, we'll forbid everything except healthz.
-			if r.URL.Path != "/healthz" {
-				writeErr(w, http.StatusUnauthorized, "auth required")
-				return
-			}
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		u, err := s.ensureDevUser(r.Context())
-		if err != nil {
-			writeErr(w, http.StatusInternalServerError, fmt.Sprintf("dev user: %v", err))
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), userCtxKey{}, u)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
+// ensureDevUser returns the single dev@local user used when APP_ENV=dev and
+// no access token is presented, creating it on first use.
 func (s *Server) ensureDevUser(ctx context.Context) (*User, error) {
 	const email = "dev@local"
 
@@ -50,7 +19,7 @@ func (s *Server) ensureDevUser(ctx context.Context) (*User, error) {
 	}
 
 	newID := uuid.New()
-	preferred = s.cfg.OpenRouterModels[0]
+	preferred = s.cfg.DefaultModel()
 	_, err = s.pool.Exec(ctx, `insert into users(id, email, password_hash, preferred_model) values ($1,$2,'', $3)`, newID, email, preferred)
 	if err != nil {
 		// could be concurrent: retry select
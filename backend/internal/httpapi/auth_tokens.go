@@ -0,0 +1,212 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errInvalidToken      = errors.New("invalid token")
+	errExpiredToken      = errors.New("token expired")
+	errRefreshTokenReuse = errors.New("refresh token reuse detected")
+)
+
+type accessClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Email     string `json:"email"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+var jwtHeaderHS256 = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// signAccessToken issues a compact HS256 JWT for the user.
+func (s *Server) signAccessToken(userID, email string, now time.Time) (string, error) {
+	claims := accessClaims{
+		Issuer:    s.cfg.JWTIssuer,
+		Subject:   userID,
+		Email:     email,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.cfg.AccessTTL).Unix(),
+		ID:        uuid.New().String(),
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeaderHS256 + "." + base64.RawURLEncoding.EncodeToString(body)
+	return signingInput + "." + s.jwtSignature(signingInput), nil
+}
+
+// parseAccessToken verifies signature, issuer and expiry and returns the claims.
+func (s *Server) parseAccessToken(token string, now time.Time) (accessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return accessClaims{}, errInvalidToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return accessClaims{}, errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil || header.Alg != "HS256" {
+		return accessClaims{}, errInvalidToken
+	}
+
+	expected := s.jwtSignature(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return accessClaims{}, errInvalidToken
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return accessClaims{}, errInvalidToken
+	}
+	var claims accessClaims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return accessClaims{}, errInvalidToken
+	}
+	if claims.Issuer != s.cfg.JWTIssuer || claims.Subject == "" {
+		return accessClaims{}, errInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return accessClaims{}, errExpiredToken
+	}
+	return claims, nil
+}
+
+func (s *Server) jwtSignature(signingInput string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSigningKey))
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens creates a fresh access/refresh pair. The refresh token row is
+// written inside tx so that rotation stays atomic.
+func (s *Server) issueTokens(ctx context.Context, tx pgx.Tx, userID, email string) (tokenPair, string, error) {
+	now := time.Now()
+	access, err := s.signAccessToken(userID, email, now)
+	if err != nil {
+		return tokenPair{}, "", err
+	}
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return tokenPair{}, "", err
+	}
+
+	var refreshID string
+	if err := tx.QueryRow(
+		ctx,
+		`insert into refresh_tokens(user_id, token_hash, expires_at) values ($1,$2,$3) returning id`,
+		userID,
+		hashRefreshToken(refresh),
+		now.Add(s.cfg.RefreshTTL),
+	).Scan(&refreshID); err != nil {
+		return tokenPair{}, "", fmt.Errorf("store refresh token: %w", err)
+	}
+
+	return tokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.AccessTTL.Seconds()),
+	}, refreshID, nil
+}
+
+// rotateRefreshToken exchanges a valid refresh token for a new pair. Presenting
+// a token that was already rotated revokes every live token of that user.
+func (s *Server) rotateRefreshToken(ctx context.Context, refresh string) (tokenPair, *User, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return tokenPair{}, nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var (
+		tokenID    string
+		user       User
+		expiresAt  time.Time
+		revokedAt  *time.Time
+		replacedBy *string
+	)
+	err = tx.QueryRow(
+		ctx,
+		`select t.id, t.expires_at, t.revoked_at, t.replaced_by, u.id, u.email, u.preferred_model
+		 from refresh_tokens t
+		 join users u on u.id=t.user_id
+		 where t.token_hash=$1
+		 for update of t`,
+		hashRefreshToken(refresh),
+	).Scan(&tokenID, &expiresAt, &revokedAt, &replacedBy, &user.ID, &user.Email, &user.PreferredModel)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tokenPair{}, nil, errInvalidToken
+		}
+		return tokenPair{}, nil, err
+	}
+
+	if revokedAt != nil {
+		if replacedBy == nil {
+			return tokenPair{}, nil, errInvalidToken
+		}
+		if _, err := tx.Exec(ctx, `update refresh_tokens set revoked_at=now() where user_id=$1 and revoked_at is null`, user.ID); err != nil {
+			return tokenPair{}, nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return tokenPair{}, nil, err
+		}
+		return tokenPair{}, nil, errRefreshTokenReuse
+	}
+	if time.Now().After(expiresAt) {
+		return tokenPair{}, nil, errExpiredToken
+	}
+
+	pair, newID, err := s.issueTokens(ctx, tx, user.ID, user.Email)
+	if err != nil {
+		return tokenPair{}, nil, err
+	}
+	if _, err := tx.Exec(ctx, `update refresh_tokens set revoked_at=now(), replaced_by=$2 where id=$1`, tokenID, newID); err != nil {
+		return tokenPair{}, nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return tokenPair{}, nil, err
+	}
+	return pair, &user, nil
+}
@@ -0,0 +1,506 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chatExportFormat and chatExportVersion identify the JSON export that
+// POST /chats/import accepts.
+const (
+	chatExportFormat  = "gosearch-ai.chat"
+	chatExportVersion = 1
+
+	exportTraceRunes = 240
+)
+
+// chatExport is a whole chat: every branch of its message tree, its runs and
+// their sources and snippets, and with the trace option the run steps.
+type chatExport struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Chat       exportChat      `json:"chat"`
+	Messages   []exportMessage `json:"messages"`
+	Runs       []exportRun     `json:"runs"`
+}
+
+type exportChat struct {
+	ID              string    `json:"id"`
+	Title           string    `json:"title"`
+	Pinned          bool      `json:"pinned"`
+	TitleEdited     bool      `json:"title_edited"`
+	ActiveMessageID *string   `json:"active_message_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type exportMessage struct {
+	ID        string     `json:"id"`
+	ParentID  *string    `json:"parent_id"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	RunID     *string    `json:"run_id"`
+	Citations []citation `json:"citations"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type exportRun struct {
+	ID               string         `json:"id"`
+	Model            string         `json:"model"`
+	Status           string         `json:"status"`
+	UserMessageID    *string        `json:"user_message_id"`
+	Error            *string        `json:"error"`
+	Degraded         bool           `json:"degraded"`
+	DegradedReason   string         `json:"degraded_reason"`
+	PromptTokens     int64          `json:"prompt_tokens"`
+	CompletionTokens int64          `json:"completion_tokens"`
+	ReasoningTokens  int64          `json:"reasoning_tokens"`
+	TotalTokens      int64          `json:"total_tokens"`
+	Cost             float64        `json:"cost"`
+	StartedAt        time.Time      `json:"started_at"`
+	FinishedAt       *time.Time     `json:"finished_at"`
+	Sources          []exportSource `json:"sources"`
+	Steps            []exportStep   `json:"steps,omitempty"`
+}
+
+type exportSource struct {
+	ID        string          `json:"id"`
+	URL       string          `json:"url"`
+	Title     string          `json:"title"`
+	Domain    string          `json:"domain"`
+	Favicon   string          `json:"favicon_url"`
+	CreatedAt time.Time       `json:"created_at"`
+	Snippets  []exportSnippet `json:"snippets"`
+}
+
+type exportSnippet struct {
+	ID        string    `json:"id"`
+	Quote     string    `json:"quote"`
+	Context   string    `json:"context"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportStep struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// loadChatExport reads the user's chat. withTrace adds the run steps.
+func (s *Server) loadChatExport(ctx context.Context, userID, chatID string, withTrace bool) (*chatExport, error) {
+	ex := &chatExport{
+		Format:     chatExportFormat,
+		Version:    chatExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Messages:   []exportMessage{},
+		Runs:       []exportRun{},
+	}
+	if err := s.pool.QueryRow(
+		ctx,
+		`select id, title, pinned, title_edited, active_message_id, created_at, updated_at
+		 from chats where id=$1 and user_id=$2 and deleted_at is null`,
+		chatID,
+		userID,
+	).Scan(&ex.Chat.ID, &ex.Chat.Title, &ex.Chat.Pinned, &ex.Chat.TitleEdited, &ex.Chat.ActiveMessageID, &ex.Chat.CreatedAt, &ex.Chat.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(
+		ctx,
+		`select id, parent_message_id, role, content, run_id, citations, created_at
+		 from messages where chat_id=$1
+		 order by created_at asc, id asc`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var m exportMessage
+		var citationsJSON []byte
+		if err := rows.Scan(&m.ID, &m.ParentID, &m.Role, &m.Content, &m.RunID, &citationsJSON, &m.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		_ = json.Unmarshal(citationsJSON, &m.Citations)
+		if m.Citations == nil {
+			m.Citations = []citation{}
+		}
+		ex.Messages = append(ex.Messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.pool.Query(
+		ctx,
+		`select id, model, status, user_message_id, error, degraded, degraded_reason,
+			prompt_tokens, completion_tokens, reasoning_tokens, total_tokens, cost, started_at, finished_at
+		 from runs where chat_id=$1
+		 order by started_at asc, id asc`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	runIdx := map[string]int{}
+	for rows.Next() {
+		var run exportRun
+		if err := rows.Scan(&run.ID, &run.Model, &run.Status, &run.UserMessageID, &run.Error, &run.Degraded, &run.DegradedReason,
+			&run.PromptTokens, &run.CompletionTokens, &run.ReasoningTokens, &run.TotalTokens, &run.Cost, &run.StartedAt, &run.FinishedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		run.Sources = []exportSource{}
+		runIdx[run.ID] = len(ex.Runs)
+		ex.Runs = append(ex.Runs, run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.pool.Query(
+		ctx,
+		`select s.run_id, s.id, s.url, s.title, s.domain, s.favicon_url, s.created_at
+		 from sources s
+		 join runs r on r.id=s.run_id
+		 where r.chat_id=$1
+		 order by s.created_at asc, s.id asc`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	sourceIdx := map[string][2]int{}
+	for rows.Next() {
+		var runID string
+		var src exportSource
+		if err := rows.Scan(&runID, &src.ID, &src.URL, &src.Title, &src.Domain, &src.Favicon, &src.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := runIdx[runID]
+		if !ok {
+			continue
+		}
+		src.Snippets = []exportSnippet{}
+		sourceIdx[src.ID] = [2]int{i, len(ex.Runs[i].Sources)}
+		ex.Runs[i].Sources = append(ex.Runs[i].Sources, src)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.pool.Query(
+		ctx,
+		`select p.source_id, p.id, p.quote, p.context, p.created_at
+		 from page_snippets p
+		 join sources s on s.id=p.source_id
+		 join runs r on r.id=s.run_id
+		 where r.chat_id=$1
+		 order by p.created_at asc, p.id asc`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var sourceID string
+		var snip exportSnippet
+		if err := rows.Scan(&sourceID, &snip.ID, &snip.Quote, &snip.Context, &snip.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if at, ok := sourceIdx[sourceID]; ok {
+			src := &ex.Runs[at[0]].Sources[at[1]]
+			src.Snippets = append(src.Snippets, snip)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !withTrace {
+		return ex, nil
+	}
+	rows, err = s.pool.Query(
+		ctx,
+		`select rs.run_id, rs.type, rs.title, rs.payload, rs.created_at
+		 from run_steps rs
+		 join runs r on r.id=rs.run_id
+		 where r.chat_id=$1
+		 order by rs.created_at asc`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runID string
+		var step exportStep
+		if err := rows.Scan(&runID, &step.Type, &step.Title, &step.Payload, &step.CreatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := runIdx[runID]; ok {
+			ex.Runs[i].Steps = append(ex.Runs[i].Steps, step)
+		}
+	}
+	return ex, rows.Err()
+}
+
+// exportReference is an entry of a report's reference list.
+type exportReference struct {
+	N          int
+	URL        string
+	Title      string
+	Domain     string
+	AccessedAt time.Time
+}
+
+type reportMessage struct {
+	Role      string
+	Model     string
+	Content   string
+	CreatedAt time.Time
+}
+
+// chatReport is the active branch of a chat ready for rendering, with the
+// per-run citation markers renumbered against one reference list.
+type chatReport struct {
+	Title      string
+	ExportedAt time.Time
+	Messages   []reportMessage
+	References []exportReference
+	Runs       []exportRun
+	Trace      bool
+}
+
+func buildChatReport(ex *chatExport, trace bool) chatReport {
+	report := chatReport{Title: ex.Chat.Title, ExportedAt: ex.ExportedAt, Trace: trace}
+	if trace {
+		report.Runs = ex.Runs
+	}
+
+	runs := make(map[string]*exportRun, len(ex.Runs))
+	sources := map[string]exportSource{}
+	for i := range ex.Runs {
+		runs[ex.Runs[i].ID] = &ex.Runs[i]
+		for _, src := range ex.Runs[i].Sources {
+			sources[src.ID] = src
+		}
+	}
+
+	refBySource := map[string]int{}
+	for _, m := range activeBranch(ex) {
+		rm := reportMessage{Role: m.Role, Content: m.Content, CreatedAt: m.CreatedAt}
+		var run *exportRun
+		if m.RunID != nil {
+			run = runs[*m.RunID]
+		}
+		if m.Role == "assistant" {
+			if run != nil {
+				rm.Model = run.Model
+			}
+			byMarker := citationSources(m, run, sources)
+			rm.Content = renumberCitations(m.Content, func(marker int) string {
+				src, ok := byMarker[marker]
+				if !ok {
+					return "?"
+				}
+				n, seen := refBySource[src.ID]
+				if !seen {
+					n = len(report.References) + 1
+					refBySource[src.ID] = n
+					report.References = append(report.References, exportReference{
+						N:          n,
+						URL:        src.URL,
+						Title:      src.Title,
+						Domain:     src.Domain,
+						AccessedAt: src.CreatedAt,
+					})
+				}
+				return strconv.Itoa(n)
+			})
+		}
+		report.Messages = append(report.Messages, rm)
+	}
+	return report
+}
+
+// activeBranch returns the messages from the root to the chat's active
+// message, or all messages when no branch is marked.
+func activeBranch(ex *chatExport) []exportMessage {
+	if ex.Chat.ActiveMessageID == nil {
+		return ex.Messages
+	}
+	byID := make(map[string]exportMessage, len(ex.Messages))
+	for _, m := range ex.Messages {
+		byID[m.ID] = m
+	}
+	var branch []exportMessage
+	for id := ex.Chat.ActiveMessageID; id != nil && len(branch) <= len(ex.Messages); {
+		m, ok := byID[*id]
+		if !ok {
+			break
+		}
+		branch = append(branch, m)
+		id = m.ParentID
+	}
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
+
+// citationSources maps an answer's markers to sources: from its verified
+// citations, or for older answers by the order the run read its sources in,
+// which is how the fetch tool numbers them.
+func citationSources(m exportMessage, run *exportRun, sources map[string]exportSource) map[int]exportSource {
+	out := map[int]exportSource{}
+	for _, c := range m.Citations {
+		if src, ok := sources[c.SourceID]; ok {
+			out[c.Marker] = src
+		}
+	}
+	if len(m.Citations) > 0 || run == nil {
+		return out
+	}
+	for i, src := range run.Sources {
+		out[i+1] = src
+	}
+	return out
+}
+
+// renumberCitations rewrites every [n] and [n, m] marker through ref.
+func renumberCitations(text string, ref func(marker int) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range citationRe.FindAllStringSubmatchIndex(text, -1) {
+		if loc[1] < len(text) && text[loc[1]] == '(' {
+			continue
+		}
+		parts := strings.Split(text[loc[2]:loc[3]], ",")
+		out := make([]string, 0, len(parts))
+		for _, raw := range parts {
+			marker, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				continue
+			}
+			out = append(out, ref(marker))
+		}
+		b.WriteString(text[last:loc[0]])
+		b.WriteString("[" + strings.Join(out, ", ") + "]")
+		last = loc[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func renderChatMarkdown(report chatReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", report.Title)
+	fmt.Fprintf(&b, "_Exported from gosearch-ai on %s_\n\n", report.ExportedAt.Format("2006-01-02 15:04 MST"))
+
+	for _, m := range report.Messages {
+		fmt.Fprintf(&b, "## %s\n\n", messageHeading(m))
+		b.WriteString(strings.TrimSpace(m.Content))
+		b.WriteString("\n\n")
+	}
+
+	if len(report.References) > 0 {
+		b.WriteString("## References\n\n")
+		for _, ref := range report.References {
+			title := ref.Title
+			if strings.TrimSpace(title) == "" {
+				title = ref.URL
+			}
+			fmt.Fprintf(&b, "%d. [%s](%s) — %s, accessed %s\n", ref.N, escapeMarkdownLinkText(title), markdownLinkDestination(ref.URL), ref.Domain, ref.AccessedAt.Format("2006-01-02"))
+		}
+		b.WriteString("\n")
+	}
+
+	if report.Trace && len(report.Runs) > 0 {
+		b.WriteString("## Run trace\n\n")
+		for i, run := range report.Runs {
+			fmt.Fprintf(&b, "### Run %d · %s · %s · %s\n\n", i+1, run.Model, run.Status, run.StartedAt.UTC().Format("2006-01-02 15:04 UTC"))
+			for _, step := range run.Steps {
+				fmt.Fprintf(&b, "- `%s` **%s** (%s)", step.CreatedAt.UTC().Format("15:04:05"), step.Title, step.Type)
+				if summary := stepSummary(step.Payload); summary != "" {
+					fmt.Fprintf(&b, " — `%s`", strings.ReplaceAll(summary, "`", "'"))
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func messageHeading(m reportMessage) string {
+	switch m.Role {
+	case "user":
+		return "Question"
+	case "assistant":
+		if m.Model != "" {
+			return "Answer (" + m.Model + ")"
+		}
+		return "Answer"
+	}
+	return strings.ToUpper(m.Role[:1]) + m.Role[1:]
+}
+
+// stepSummary is the step payload as one line of compact JSON.
+func stepSummary(payload json.RawMessage) string {
+	if len(payload) == 0 || string(payload) == "null" || string(payload) == "{}" {
+		return ""
+	}
+	summary := normalizeWhitespace(string(payload))
+	if short := truncateRunes(summary, exportTraceRunes); short != summary {
+		summary = short + "…"
+	}
+	return summary
+}
+
+func escapeMarkdownLinkText(text string) string {
+	return strings.NewReplacer("[", "\\[", "]", "\\]").Replace(text)
+}
+
+// markdownLinkDestination wraps a URL in angle brackets, so parentheses and
+// brackets in it cannot end the link early.
+func markdownLinkDestination(u string) string {
+	return "<" + strings.NewReplacer("<", "%3C", ">", "%3E", " ", "%20", "\n", "", "\r", "").Replace(u) + ">"
+}
+
+// exportFilename is an ASCII file name for the Content-Disposition header.
+func exportFilename(ex *chatExport, ext string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(ex.Chat.Title) {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 60 {
+			break
+		}
+	}
+	name := strings.Trim(b.String(), "-")
+	if name == "" {
+		name = "chat-" + ex.Chat.ID[:min(8, len(ex.Chat.ID))]
+	}
+	return name + "." + ext
+}
@@ -0,0 +1,219 @@
+package httpapi
+
+import (
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The HTML report is one file with inline styles, so it opens offline and can
+// be mailed or archived as is. Answers are rendered from the subset of
+// Markdown the models write; anything else is kept as escaped text.
+
+var (
+	mdHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBulletRe  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdOrderedRe = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	mdCodeRe    = regexp.MustCompile("`([^`]+)`")
+	mdBoldRe    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdLinkRe    = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)]+)\)`)
+	mdRefRe     = regexp.MustCompile(`\[(\d+(?:,\s*\d+)*)\]`)
+	mdRefNumRe  = regexp.MustCompile(`\d+`)
+)
+
+var chatReportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"heading":  messageHeading,
+	"markdown": markdownHTML,
+	"date":     func(r exportReference) string { return r.AccessedAt.Format("2006-01-02") },
+	"inc":      func(i int) int { return i + 1 },
+	"summary":  func(step exportStep) string { return stepSummary(step.Payload) },
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{font:16px/1.6 -apple-system,BlinkMacSystemFont,"Segoe UI",Roboto,sans-serif;color:#1f2328;max-width:760px;margin:2rem auto;padding:0 1rem}
+header{border-bottom:1px solid #d0d7de;margin-bottom:1.5rem}
+.meta{color:#656d76;font-size:.875rem}
+section.message{margin:1.5rem 0}
+section.user{background:#f6f8fa;border-radius:8px;padding:.75rem 1rem}
+h2.role{font-size:.8rem;text-transform:uppercase;letter-spacing:.05em;color:#656d76;margin:0 0 .5rem}
+pre{background:#f6f8fa;border-radius:6px;padding:.75rem;overflow-x:auto;font-size:.85rem}
+code{font-family:ui-monospace,SFMono-Regular,Menlo,monospace;font-size:.9em}
+blockquote{border-left:3px solid #d0d7de;margin:0;padding-left:1rem;color:#656d76}
+sup a{text-decoration:none}
+ol.refs li{margin:.25rem 0}
+ol.refs .domain,.trace .type{color:#656d76}
+.trace{font-size:.85rem}
+.trace code{word-break:break-all}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p class="meta">Exported from gosearch-ai on {{.ExportedAt.Format "2006-01-02 15:04 MST"}}</p>
+</header>
+{{range .Messages}}<section class="message {{.Role}}">
+<h2 class="role">{{heading .}}</h2>
+{{markdown .Content}}
+</section>
+{{end}}{{if .References}}<section class="references">
+<h2>References</h2>
+<ol class="refs">
+{{range .References}}<li id="ref-{{.N}}"><a href="{{.URL}}">{{if .Title}}{{.Title}}{{else}}{{.URL}}{{end}}</a> <span class="domain">— {{.Domain}}, accessed {{date .}}</span></li>
+{{end}}</ol>
+</section>
+{{end}}{{if and .Trace .Runs}}<section class="trace">
+<h2>Run trace</h2>
+{{range $i, $run := .Runs}}<h3>Run {{inc $i}} · {{$run.Model}} · {{$run.Status}} · {{$run.StartedAt.UTC.Format "2006-01-02 15:04 UTC"}}</h3>
+<ul>
+{{range $run.Steps}}<li><code>{{.CreatedAt.UTC.Format "15:04:05"}}</code> <strong>{{.Title}}</strong> <span class="type">({{.Type}})</span>{{with summary .}} <code>{{.}}</code>{{end}}</li>
+{{end}}</ul>
+{{end}}</section>
+{{end}}</body>
+</html>
+`))
+
+func renderChatHTML(w io.Writer, report chatReport) error {
+	return chatReportTmpl.Execute(w, report)
+}
+
+// markdownHTML renders answer Markdown: headings, lists, fenced code, quotes,
+// tables (kept preformatted), inline code, bold, links and [n] references.
+func markdownHTML(text string) template.HTML {
+	var b strings.Builder
+	var para []string
+	list := ""
+	inCode := false
+	var block []string
+
+	flushPara := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + strings.Join(para, "<br>\n") + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			closeList()
+			b.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+	flushBlock := func() {
+		if len(block) > 0 {
+			b.WriteString("<pre>" + html.EscapeString(strings.Join(block, "\n")) + "</pre>\n")
+			block = nil
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				b.WriteString("<pre><code>" + html.EscapeString(strings.Join(block, "\n")) + "</code></pre>\n")
+				block = nil
+				inCode = false
+			} else {
+				flushPara()
+				closeList()
+				flushBlock()
+				inCode = true
+			}
+			continue
+		}
+		if inCode {
+			block = append(block, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "|") {
+			flushPara()
+			closeList()
+			block = append(block, trimmed)
+			continue
+		}
+		flushBlock()
+
+		switch {
+		case trimmed == "":
+			flushPara()
+			closeList()
+		case mdHeadingRe.MatchString(trimmed):
+			flushPara()
+			closeList()
+			m := mdHeadingRe.FindStringSubmatch(trimmed)
+			// Message roles are h2, so answer headings start at h3.
+			level := min(len(m[1])+2, 6)
+			tag := "h" + strconv.Itoa(level)
+			b.WriteString("<" + tag + ">" + inlineMarkdownHTML(m[2]) + "</" + tag + ">\n")
+		case mdBulletRe.MatchString(line):
+			flushPara()
+			openList("ul")
+			b.WriteString("<li>" + inlineMarkdownHTML(mdBulletRe.FindStringSubmatch(line)[1]) + "</li>\n")
+		case mdOrderedRe.MatchString(line):
+			flushPara()
+			openList("ol")
+			b.WriteString("<li>" + inlineMarkdownHTML(mdOrderedRe.FindStringSubmatch(line)[1]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushPara()
+			closeList()
+			b.WriteString("<blockquote>" + inlineMarkdownHTML(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		default:
+			closeList()
+			para = append(para, inlineMarkdownHTML(trimmed))
+		}
+	}
+	if inCode {
+		b.WriteString("<pre><code>" + html.EscapeString(strings.Join(block, "\n")) + "</code></pre>\n")
+		block = nil
+	}
+	flushBlock()
+	flushPara()
+	closeList()
+	return template.HTML(b.String())
+}
+
+// inlineMarkdownHTML escapes text first, so the patterns below only ever see
+// escaped input and cannot produce markup the answer did not ask for. Code
+// spans and link targets are set aside meanwhile, so a URL such as
+// https://host/page[1] is not rewritten into a reference.
+func inlineMarkdownHTML(text string) string {
+	var codes []string
+	out := mdCodeRe.ReplaceAllStringFunc(text, func(m string) string {
+		codes = append(codes, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00" + strconv.Itoa(len(codes)-1) + "\x00"
+	})
+	out = html.EscapeString(out)
+	var hrefs []string
+	out = mdLinkRe.ReplaceAllStringFunc(out, func(m string) string {
+		sub := mdLinkRe.FindStringSubmatch(m)
+		hrefs = append(hrefs, sub[2])
+		return `<a href="` + "\x01" + strconv.Itoa(len(hrefs)-1) + "\x01" + `">` + sub[1] + "</a>"
+	})
+	out = mdBoldRe.ReplaceAllString(out, "<strong>$1</strong>")
+	out = mdRefRe.ReplaceAllStringFunc(out, func(m string) string {
+		var refs strings.Builder
+		for _, n := range mdRefNumRe.FindAllString(m, -1) {
+			refs.WriteString(`<sup><a href="#ref-` + n + `">[` + n + `]</a></sup>`)
+		}
+		return refs.String()
+	})
+	for i, href := range hrefs {
+		out = strings.Replace(out, "\x01"+strconv.Itoa(i)+"\x01", href, 1)
+	}
+	for i, code := range codes {
+		out = strings.Replace(out, "\x00"+strconv.Itoa(i)+"\x00", code, 1)
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import "testing"
+
+func TestInlineMarkdownHTML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain [1]", `plain <sup><a href="#ref-1">[1]</a></sup>`},
+		{"[x](https://a/b)", `<a href="https://a/b">x</a>`},
+		{"[x](https://a/b[1]) [2]", `<a href="https://a/b[1]">x</a> <sup><a href="#ref-2">[2]</a></sup>`},
+		{"[x](https://a/?q=\"><b>)", `<a href="https://a/?q=&#34;&gt;&lt;b&gt;">x</a>`},
+		{"**bold** `[3]`", `<strong>bold</strong> <code>[3]</code>`},
+	}
+	for _, tt := range tests {
+		if got := inlineMarkdownHTML(tt.in); got != tt.want {
+			t.Errorf("inlineMarkdownHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownLinkDestination(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://a/b", "<https://a/b>"},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language)", "<https://en.wikipedia.org/wiki/Go_(programming_language)>"},
+		{"https://a/b[1] c", "<https://a/b[1]%20c>"},
+		{"https://a/<x>", "<https://a/%3Cx%3E>"},
+	}
+	for _, tt := range tests {
+		if got := markdownLinkDestination(tt.in); got != tt.want {
+			t.Errorf("markdownLinkDestination(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var errInvalidImport = errors.New("invalid chat export")
+
+// importChat stores an export as a new chat of userID. Every row gets a new
+// id, so the same file can be imported twice or on the instance it came from;
+// references to rows missing from the file are dropped. Runs that were not
+// done when exported are stored as failed, since no worker owns them.
+func (s *Server) importChat(ctx context.Context, userID string, ex *chatExport) (string, error) {
+	if ex.Format != chatExportFormat {
+		return "", fmt.Errorf("%w: format must be %s", errInvalidImport, chatExportFormat)
+	}
+	if ex.Version < 1 || ex.Version > chatExportVersion {
+		return "", fmt.Errorf("%w: unsupported version %d", errInvalidImport, ex.Version)
+	}
+
+	ids := map[string]string{}
+	newID := func(old string) string {
+		id := uuid.NewString()
+		if old != "" {
+			ids[old] = id
+		}
+		return id
+	}
+	ref := func(old *string) *string {
+		if old == nil {
+			return nil
+		}
+		if id, ok := ids[*old]; ok {
+			return &id
+		}
+		return nil
+	}
+
+	title := strings.TrimSpace(ex.Chat.Title)
+	if title == "" {
+		title = "Imported chat"
+	}
+	title = truncateRunes(title, chatTitleMaxRunes)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	chatID := newID(ex.Chat.ID)
+	if _, err := tx.Exec(
+		ctx,
+		`insert into chats(id, user_id, title, pinned, title_edited, created_at, updated_at)
+		 values ($1, $2, $3, $4, $5, $6, now())`,
+		chatID, userID, title, ex.Chat.Pinned, ex.Chat.TitleEdited, importTime(ex.Chat.CreatedAt),
+	); err != nil {
+		return "", err
+	}
+
+	for _, run := range ex.Runs {
+		status := run.Status
+		runErr := run.Error
+		switch status {
+		case "finished", "failed", "cancelled":
+		default:
+			status = "failed"
+			msg := "interrupted by export"
+			runErr = &msg
+		}
+		if _, err := tx.Exec(
+			ctx,
+			`insert into runs(id, chat_id, user_id, model, status, error, degraded, degraded_reason,
+				prompt_tokens, completion_tokens, reasoning_tokens, total_tokens, cost, started_at, finished_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			newID(run.ID), chatID, userID, run.Model, status, runErr, run.Degraded, run.DegradedReason,
+			run.PromptTokens, run.CompletionTokens, run.ReasoningTokens, run.TotalTokens, run.Cost, importTime(run.StartedAt), run.FinishedAt,
+		); err != nil {
+			return "", err
+		}
+		for _, src := range run.Sources {
+			if _, err := tx.Exec(
+				ctx,
+				`insert into sources(id, run_id, url, title, domain, favicon_url, created_at)
+				 values ($1, $2, $3, $4, $5, $6, $7)`,
+				newID(src.ID), ids[run.ID], src.URL, src.Title, src.Domain, src.Favicon, importTime(src.CreatedAt),
+			); err != nil {
+				return "", err
+			}
+			for _, snip := range src.Snippets {
+				if _, err := tx.Exec(
+					ctx,
+					`insert into page_snippets(id, source_id, quote, context, created_at)
+					 values ($1, $2, $3, $4, $5)`,
+					newID(snip.ID), ids[src.ID], snip.Quote, snip.Context, importTime(snip.CreatedAt),
+				); err != nil {
+					return "", err
+				}
+			}
+		}
+		for _, step := range run.Steps {
+			payload := step.Payload
+			if len(payload) == 0 {
+				payload = []byte("{}")
+			}
+			if _, err := tx.Exec(
+				ctx,
+				`insert into run_steps(run_id, type, title, payload, created_at)
+				 values ($1, $2, $3, $4, $5)`,
+				ids[run.ID], step.Type, step.Title, payload, importTime(step.CreatedAt),
+			); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, m := range parentsFirst(ex.Messages) {
+		switch m.Role {
+		case "user", "assistant", "system":
+		default:
+			return "", fmt.Errorf("%w: message %s has role %q", errInvalidImport, m.ID, m.Role)
+		}
+		citations := make([]citation, 0, len(m.Citations))
+		for _, c := range m.Citations {
+			c.SourceID = stringRef(ids, c.SourceID)
+			c.SnippetID = stringRef(ids, c.SnippetID)
+			citations = append(citations, c)
+		}
+		citationsJSON, err := json.Marshal(citations)
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec(
+			ctx,
+			`insert into messages(id, chat_id, user_id, role, content, run_id, parent_message_id, citations, created_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			newID(m.ID), chatID, userID, m.Role, m.Content, ref(m.RunID), ref(m.ParentID), citationsJSON, importTime(m.CreatedAt),
+		); err != nil {
+			return "", err
+		}
+	}
+
+	for _, run := range ex.Runs {
+		if msgID := ref(run.UserMessageID); msgID != nil {
+			if _, err := tx.Exec(ctx, `update runs set user_message_id=$2 where id=$1`, ids[run.ID], *msgID); err != nil {
+				return "", err
+			}
+		}
+	}
+	if _, err := tx.Exec(ctx, `update chats set active_message_id=$2 where id=$1`, chatID, ref(ex.Chat.ActiveMessageID)); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return chatID, nil
+}
+
+// parentsFirst orders messages so every parent precedes its children.
+// Messages whose parent is not in the file become roots, and a cycle is cut
+// at its first message.
+func parentsFirst(messages []exportMessage) []exportMessage {
+	byID := make(map[string]bool, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = true
+	}
+	children := map[string][]exportMessage{}
+	var queue []exportMessage
+	for _, m := range messages {
+		if m.ParentID != nil && byID[*m.ParentID] && *m.ParentID != m.ID {
+			children[*m.ParentID] = append(children[*m.ParentID], m)
+			continue
+		}
+		queue = append(queue, m)
+	}
+
+	out := make([]exportMessage, 0, len(messages))
+	placed := make(map[string]bool, len(messages))
+	for next := 0; ; {
+		for len(queue) > 0 {
+			m := queue[0]
+			queue = queue[1:]
+			if placed[m.ID] {
+				continue
+			}
+			placed[m.ID] = true
+			out = append(out, m)
+			queue = append(queue, children[m.ID]...)
+		}
+		for next < len(messages) && placed[messages[next].ID] {
+			next++
+		}
+		if next == len(messages) {
+			return out
+		}
+		m := messages[next]
+		m.ParentID = nil
+		queue = append(queue, m)
+	}
+}
+
+func stringRef(ids map[string]string, old string) string {
+	if old == "" {
+		return ""
+	}
+	return ids[old]
+}
+
+// importTime stands in now for timestamps missing from the file.
+func importTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// isImportInputErr reports whether err comes from the file rather than the
+// server: a failed check, or ids, timestamps and values Postgres rejects.
+func isImportInputErr(err error) bool {
+	if errors.Is(err, errInvalidImport) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
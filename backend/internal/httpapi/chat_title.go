@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	chatTitleTimeout = 20 * time.Second
+	// chatTitleWait is how long run.finished waits for a title still being
+	// generated; a slower title is emitted after it.
+	chatTitleWait         = 2 * time.Second
+	chatTitleAnswerRunes  = 1500
+	chatTitleResultRunes  = 80
+	chatTitleSystemPrompt = "Write a short title, at most six words, for a chat that starts with the exchange below. " +
+		"Use the language of the question. Reply with the title only: no quotes, no Markdown, no final period."
+)
+
+// startChatTitle generates the title in the background, detached from the
+// run's deadline. The returned channel is closed when it is done; cancel
+// abandons it, e.g. when the answer could not be stored.
+func (s *Server) startChatTitle(ctx context.Context, runID, query string, result agentResult) (<-chan struct{}, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		s.titleChat(ctx, runID, query, result)
+	}()
+	return done, cancel
+}
+
+// titleChat names the chat from its first successful run, unless the user
+// has renamed it, and emits chat.title on the run's stream. Failures only
+// leave the original title (the first query) in place.
+func (s *Server) titleChat(ctx context.Context, runID, query string, result agentResult) {
+	ctx, cancel := context.WithTimeout(ctx, chatTitleTimeout)
+	defer cancel()
+
+	// Runs alongside the run being marked finished, so it only looks for
+	// other finished runs.
+	var chatID string
+	err := s.pool.QueryRow(
+		ctx,
+		`select c.id from runs r
+		 join chats c on c.id=r.chat_id
+		 where r.id=$1 and not c.title_edited
+			and not exists(select 1 from runs o where o.chat_id=c.id and o.id<>r.id and o.status='finished')`,
+		runID,
+	).Scan(&chatID)
+	if err != nil {
+		// not the chat's first run, or renamed by the user
+		return
+	}
+
+	model := s.cfg.ChatTitleModel
+	if model == "" {
+		model = result.Model
+	}
+	provider, _, err := s.llmProvider(model)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("chat title failed")
+		return
+	}
+	messages := []map[string]any{
+		{"role": "system", "content": chatTitleSystemPrompt},
+		{"role": "user", "content": "Question: " + query + "\n\nAnswer: " + truncateRunes(result.Answer, chatTitleAnswerRunes)},
+	}
+
+	started := time.Now()
+	body, err := provider.ChatCompletion(ctx, llmRequest{Model: model, Messages: messages})
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("chat title failed")
+		return
+	}
+	out, err := decodeChatCompletion(body)
+	_ = body.Close()
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("chat title failed")
+		return
+	}
+	s.recordStepUsage(ctx, runID, model, provider.Name(), messages, out, time.Since(started))
+
+	title := cleanChatTitle(out.Content)
+	if title == "" {
+		return
+	}
+	tag, err := s.pool.Exec(ctx, `update chats set title=$2 where id=$1 and not title_edited`, chatID, title)
+	if err != nil || tag.RowsAffected() == 0 {
+		return
+	}
+	s.emitEvent(ctx, runID, "chat.title", map[string]any{"chat_id": chatID, "title": title})
+}
+
+// cleanChatTitle keeps the first line of the reply without the quotes,
+// heading marks and trailing punctuation models tend to add.
+func cleanChatTitle(raw string) string {
+	title := strings.TrimSpace(raw)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimSpace(strings.TrimLeft(title, "#* "))
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.TrimFunc(title, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"'«»“”*.`, r)
+	})
+	if short := truncateRunes(title, chatTitleResultRunes); short != title {
+		title = strings.TrimSpace(short) + "…"
+	}
+	return title
+}
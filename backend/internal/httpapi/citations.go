@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// citationSupported is the share of claim terms a snippet must contain
+	// for the citation to count as supported.
+	citationSupported = 0.3
+	// citationStemRunes folds inflected forms (English and Russian alike)
+	// onto a common prefix before comparing terms.
+	citationStemRunes = 5
+)
+
+// citation statuses
+const (
+	citationOK           = "supported"
+	citationWeak         = "weak"
+	citationUnverifiable = "unverifiable"
+	citationDangling     = "dangling"
+)
+
+// citationRe matches [1] and [1, 2] but not Markdown links like [1](url).
+var citationRe = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// citation is one [n] in an answer, in order of appearance, resolved to the
+// fetched source and the snippet that best supports the sentence around it.
+type citation struct {
+	Marker     int     `json:"marker"`
+	SourceID   string  `json:"source_id,omitempty"`
+	URL        string  `json:"url,omitempty"`
+	SnippetID  string  `json:"snippet_id,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Status     string  `json:"status"`
+}
+
+// verifyCitations resolves the answer's citation markers against the sources
+// the fetch tool returned and publishes a citations.verified step.
+func (s *Server) verifyCitations(ctx context.Context, runID, answer string, evidence []toolSource) []citation {
+	citations := parseCitations(answer, evidence)
+	if len(citations) == 0 && len(evidence) == 0 {
+		return citations
+	}
+
+	counts := map[string]int{}
+	dangling := []int{}
+	for _, c := range citations {
+		counts[c.Status]++
+		if c.Status == citationDangling {
+			dangling = append(dangling, c.Marker)
+		}
+	}
+	s.publishStep(ctx, runID, "citations.verified", "Citations checked", map[string]any{
+		"total":        len(citations),
+		"supported":    counts[citationOK],
+		"weak":         counts[citationWeak],
+		"unverifiable": counts[citationUnverifiable],
+		"dangling":     dangling,
+	})
+	return citations
+}
+
+func parseCitations(answer string, evidence []toolSource) []citation {
+	byRef := make(map[int]toolSource, len(evidence))
+	for _, source := range evidence {
+		byRef[source.Ref] = source
+	}
+
+	citations := []citation{}
+	claimStart := 0
+	claim := ""
+	for _, loc := range citationRe.FindAllStringSubmatchIndex(answer, -1) {
+		if loc[1] < len(answer) && answer[loc[1]] == '(' {
+			continue
+		}
+		// Adjacent markers such as [1][2] cite the same claim.
+		if next := claimBefore(answer[claimStart:loc[0]]); next != "" {
+			claim = next
+		}
+		claimStart = loc[1]
+		for _, raw := range strings.Split(answer[loc[2]:loc[3]], ",") {
+			marker, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				continue
+			}
+			citations = append(citations, resolveCitation(marker, claim, byRef))
+		}
+	}
+	return citations
+}
+
+func resolveCitation(marker int, claim string, byRef map[int]toolSource) citation {
+	c := citation{Marker: marker, Status: citationDangling}
+	source, ok := byRef[marker]
+	if !ok {
+		return c
+	}
+	c.SourceID = source.SourceID
+	c.URL = source.URL
+	c.Status = citationUnverifiable
+
+	terms := stemTerms(claim)
+	if len(terms) == 0 || len(source.Snippets) == 0 {
+		return c
+	}
+	for _, snip := range source.Snippets {
+		snipTerms := map[string]struct{}{}
+		for _, t := range stemTerms(snip.Text) {
+			snipTerms[t] = struct{}{}
+		}
+		matched := 0
+		for _, t := range terms {
+			if _, ok := snipTerms[t]; ok {
+				matched++
+			}
+		}
+		if score := float64(matched) / float64(len(terms)); score > c.Confidence || c.SnippetID == "" {
+			c.Confidence = score
+			c.SnippetID = snip.ID
+		}
+	}
+	c.Confidence = math.Round(c.Confidence*100) / 100
+	c.Status = citationWeak
+	if c.Confidence >= citationSupported {
+		c.Status = citationOK
+	}
+	return c
+}
+
+// claimBefore returns the sentence that ends at a citation marker: the text
+// after the last sentence break or line break.
+func claimBefore(text string) string {
+	text = strings.TrimRight(text, " \t")
+	cut := strings.LastIndexAny(strings.TrimRight(text, ".!?"), ".!?\n")
+	return strings.TrimSpace(text[cut+1:])
+}
+
+func stemTerms(text string) []string {
+	tokens := tokenize(text)
+	for i, tok := range tokens {
+		if utf8.RuneCountInString(tok) > citationStemRunes {
+			tokens[i] = string([]rune(tok)[:citationStemRunes])
+		}
+	}
+	return uniqueTerms(tokens)
+}
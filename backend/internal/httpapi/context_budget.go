@@ -0,0 +1,226 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// compactedStringRunes is how long strings inside an older tool result
+	// may stay once the result has been compacted.
+	compactedStringRunes = 160
+	// historyMessageRunes caps earlier chat messages before they are dropped.
+	historyMessageRunes = 1500
+	// messageOverheadTokens approximates role and framing tokens per message.
+	messageOverheadTokens = 4
+
+	truncatedMarker = "\n[truncated]"
+)
+
+// contextWindow tracks the conversation sent to the model. Everything between
+// the system prompt and queryIdx is chat history; everything after it belongs
+// to the current run.
+type contextWindow struct {
+	messages []map[string]any
+	queryIdx int
+}
+
+type trimReport struct {
+	CompactedTools   int
+	TruncatedTools   int
+	TruncatedHistory int
+	DroppedHistory   int
+}
+
+func (r trimReport) empty() bool {
+	return r == trimReport{}
+}
+
+// contextLimit is the prompt budget for model: its context window minus the
+// tokens reserved for the reply.
+func (s *Server) contextLimit(model string) int {
+	mc, _ := s.cfg.Model(model)
+	limit := mc.ContextLength
+	if limit <= 0 {
+		limit = s.cfg.ContextDefaultTokens
+	}
+	limit -= s.cfg.ContextReserveTokens
+	if limit < 1024 {
+		limit = 1024
+	}
+	return limit
+}
+
+// fitContext shrinks the conversation until it fits the model's budget, in
+// order of least to most useful: older tool outputs are compacted, long
+// history messages truncated, then the oldest history dropped, and as a last
+// resort the current tool outputs are compacted and cut. Trimming is kept on
+// w, so each reduction is reported once in a context.trimmed step.
+func (s *Server) fitContext(ctx context.Context, runID, model string, w *contextWindow, tools []map[string]any) {
+	limit := s.contextLimit(model) - estimateJSONTokens(tools)
+	before := w.tokens()
+	if before <= limit {
+		return
+	}
+
+	var report trimReport
+	lastTurn := w.lastAssistantIdx()
+	fits := func() bool { return w.tokens() <= limit }
+
+	for i := w.queryIdx + 1; i < lastTurn && !fits(); i++ {
+		if compactToolMessage(w.messages[i]) {
+			report.CompactedTools++
+		}
+	}
+	for i := 1; i < w.queryIdx && !fits(); i++ {
+		if truncateMessage(w.messages[i], historyMessageRunes) {
+			report.TruncatedHistory++
+		}
+	}
+	for w.queryIdx > 1 && !fits() {
+		// Drop a whole turn, so the history never starts with an assistant
+		// reply whose question is gone.
+		n := 1
+		for 1+n < w.queryIdx && w.messages[1+n]["role"] != "user" {
+			n++
+		}
+		w.messages = append(w.messages[:1], w.messages[1+n:]...)
+		w.queryIdx -= n
+		report.DroppedHistory += n
+	}
+	for i := w.queryIdx + 1; i < len(w.messages) && !fits(); i++ {
+		if compactToolMessage(w.messages[i]) {
+			report.CompactedTools++
+		}
+	}
+	for i := w.queryIdx + 1; i < len(w.messages) && !fits(); i++ {
+		if w.messages[i]["role"] != "tool" {
+			continue
+		}
+		excess := (w.tokens() - limit) * 4
+		content, _ := w.messages[i]["content"].(string)
+		keep := utf8.RuneCountInString(content) - excess
+		if keep < compactedStringRunes {
+			keep = compactedStringRunes
+		}
+		if truncateMessage(w.messages[i], keep) {
+			report.TruncatedTools++
+		}
+	}
+
+	after := w.tokens()
+	if after > limit {
+		s.logger.Warn().Str("run_id", runID).Str("model", model).Int("tokens", after).Int("limit", limit).Msg("context still over budget")
+	}
+	if report.empty() {
+		return
+	}
+	s.publishStep(ctx, runID, "context.trimmed", "Context trimmed", map[string]any{
+		"model":                  model,
+		"limit":                  limit,
+		"tokens_before":          before,
+		"tokens_after":           after,
+		"compacted_tool_outputs": report.CompactedTools,
+		"truncated_tool_outputs": report.TruncatedTools,
+		"truncated_history":      report.TruncatedHistory,
+		"dropped_history":        report.DroppedHistory,
+	})
+}
+
+func (w *contextWindow) tokens() int {
+	total := 0
+	for _, msg := range w.messages {
+		total += estimateJSONTokens(msg) + messageOverheadTokens
+	}
+	return total
+}
+
+func (w *contextWindow) lastAssistantIdx() int {
+	for i := len(w.messages) - 1; i > w.queryIdx; i-- {
+		if w.messages[i]["role"] == "assistant" {
+			return i
+		}
+	}
+	return len(w.messages)
+}
+
+// compactToolMessage shortens every long string inside a tool result, which
+// keeps its shape (URLs, titles, refs, snippet ids) but drops the bulk text.
+func compactToolMessage(msg map[string]any) bool {
+	if msg["role"] != "tool" {
+		return false
+	}
+	content, _ := msg["content"].(string)
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return truncateMessage(msg, compactedStringRunes*4)
+	}
+	raw, err := json.Marshal(compactJSONValue(value))
+	if err != nil {
+		return false
+	}
+	if len(raw) >= len(content) {
+		return false
+	}
+	msg["content"] = string(raw)
+	return true
+}
+
+func compactJSONValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return truncateRunes(v, compactedStringRunes)
+	case []any:
+		for i := range v {
+			v[i] = compactJSONValue(v[i])
+		}
+		return v
+	case map[string]any:
+		for k := range v {
+			v[k] = compactJSONValue(v[k])
+		}
+		return v
+	}
+	return value
+}
+
+func truncateMessage(msg map[string]any, maxRunes int) bool {
+	content, ok := msg["content"].(string)
+	if !ok {
+		return false
+	}
+	text := strings.TrimSuffix(content, truncatedMarker)
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return false
+	}
+	truncated := truncateRunes(text, maxRunes) + truncatedMarker
+	if truncated == content {
+		return false
+	}
+	msg["content"] = truncated
+	return true
+}
+
+func estimateJSONTokens(v any) int {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return estimateTokens(string(raw))
+}
+
+// estimateTokens approximates a BPE token count: about four characters per
+// token for ASCII text and about two for other scripts such as Cyrillic.
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + (other+1)/2
+}
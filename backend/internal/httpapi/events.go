@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+// runEvent is one SSE frame for a run. Seq is the per-run sequence written
+// as the SSE id (0 if the event could not be stored).
+type runEvent struct {
+	RunID string `json:"run_id"`
+	Seq   int64  `json:"seq"`
+	Frame []byte `json:"frame"`
+}
+
+// eventBroker fans run events out to SSE subscribers, possibly across
+// replicas.
+type eventBroker interface {
+	publish(ev runEvent)
+	subscribe(runID string) chan runEvent
+	unsubscribe(runID string, ch chan runEvent)
+	// run blocks until ctx is done; brokers without background work return at once.
+	run(ctx context.Context)
+}
+
+// memoryBroker delivers events only to subscribers in this process. It is
+// the single-node default.
+type memoryBroker struct {
+	hub *sseHub
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{hub: newSSEHub()}
+}
+
+func (b *memoryBroker) publish(ev runEvent) { b.hub.deliver(ev) }
+
+func (b *memoryBroker) subscribe(runID string) chan runEvent { return b.hub.subscribe(runID) }
+
+func (b *memoryBroker) unsubscribe(runID string, ch chan runEvent) { b.hub.unsubscribe(runID, ch) }
+
+func (b *memoryBroker) run(context.Context) {}
+
+// newEventBroker picks the broker named by EVENT_BROKER; config validation
+// has already rejected unknown names.
+func newEventBroker(cfg config.Config, pool *pgxpool.Pool, logger zerolog.Logger) eventBroker {
+	if cfg.EventBroker == "postgres" {
+		return newPGBroker(pool, logger)
+	}
+	return newMemoryBroker()
+}
+
+// RunEventBroker runs the broker's background loop (for example the
+// Postgres listener) until ctx is done.
+func (s *Server) RunEventBroker(ctx context.Context) {
+	s.events.run(ctx)
+}
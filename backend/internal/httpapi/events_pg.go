@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+const (
+	pgEventChannel = "run_events"
+	// NOTIFY payloads are capped at 8000 bytes; chunks are base64 encoded
+	// inside the envelope, so they are kept well below that.
+	pgEventChunkSize = 5000
+)
+
+// pgEnvelope is the NOTIFY payload. Large events are split into several
+// envelopes sent in one transaction, so they arrive together and in order.
+type pgEnvelope struct {
+	Origin string `json:"o"`
+	ID     string `json:"m"`
+	Index  int    `json:"i"`
+	Total  int    `json:"n"`
+	Data   []byte `json:"d"`
+}
+
+// pgBroker delivers events locally and relays them to other replicas through
+// Postgres LISTEN/NOTIFY. Notifications from this process are ignored by its
+// own listener.
+type pgBroker struct {
+	hub    *sseHub
+	pool   *pgxpool.Pool
+	logger zerolog.Logger
+	origin string
+}
+
+func newPGBroker(pool *pgxpool.Pool, logger zerolog.Logger) *pgBroker {
+	return &pgBroker{hub: newSSEHub(), pool: pool, logger: logger, origin: uuid.New().String()}
+}
+
+func (b *pgBroker) subscribe(runID string) chan runEvent { return b.hub.subscribe(runID) }
+
+func (b *pgBroker) unsubscribe(runID string, ch chan runEvent) { b.hub.unsubscribe(runID, ch) }
+
+func (b *pgBroker) publish(ev runEvent) {
+	b.hub.deliver(ev)
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	id := uuid.New().String()
+	total := (len(data) + pgEventChunkSize - 1) / pgEventChunkSize
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tx, err := b.pool.Begin(ctx)
+	if err != nil {
+		b.logger.Warn().Err(err).Str("run_id", ev.RunID).Msg("event notify failed")
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	for i := 0; i < total; i++ {
+		end := min((i+1)*pgEventChunkSize, len(data))
+		env, _ := json.Marshal(pgEnvelope{Origin: b.origin, ID: id, Index: i, Total: total, Data: data[i*pgEventChunkSize : end]})
+		if _, err := tx.Exec(ctx, `select pg_notify($1, $2)`, pgEventChannel, string(env)); err != nil {
+			b.logger.Warn().Err(err).Str("run_id", ev.RunID).Msg("event notify failed")
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		b.logger.Warn().Err(err).Str("run_id", ev.RunID).Msg("event notify failed")
+	}
+}
+
+// run listens for notifications from other replicas, reconnecting with a
+// short backoff when the listening connection drops.
+func (b *pgBroker) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := b.listen(ctx); err != nil && ctx.Err() == nil {
+			b.logger.Warn().Err(err).Msg("event listener disconnected")
+			select {
+			case <-ctx.Done():
+			case <-time.After(2 * time.Second):
+			}
+		}
+	}
+}
+
+func (b *pgBroker) listen(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN state must not leak back into the pool.
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err := pgConn.Exec(ctx, "listen "+pgEventChannel); err != nil {
+		return err
+	}
+	b.logger.Info().Str("channel", pgEventChannel).Msg("event listener started")
+
+	pending := map[string][][]byte{}
+	for {
+		n, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var env pgEnvelope
+		if err := json.Unmarshal([]byte(n.Payload), &env); err != nil || env.Origin == b.origin {
+			continue
+		}
+		if env.Total <= 0 || env.Index < 0 || env.Index >= env.Total {
+			continue
+		}
+
+		parts := pending[env.ID]
+		if parts == nil {
+			parts = make([][]byte, env.Total)
+			pending[env.ID] = parts
+		}
+		parts[env.Index] = env.Data
+		if env.Index != env.Total-1 {
+			continue
+		}
+		delete(pending, env.ID)
+
+		var data []byte
+		complete := true
+		for _, part := range parts {
+			if part == nil {
+				complete = false
+				break
+			}
+			data = append(data, part...)
+		}
+		if !complete {
+			continue
+		}
+		var ev runEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			continue
+		}
+		b.hub.deliver(ev)
+	}
+}
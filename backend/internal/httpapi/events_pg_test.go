@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// TestPGBrokerRelay starts a listener on one broker and publishes from
+// another, as two replicas would. It needs a Postgres in TEST_DATABASE_URL.
+func TestPGBrokerRelay(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	listener := newPGBroker(pool, zerolog.Nop())
+	sender := newPGBroker(pool, zerolog.Nop())
+	runID := "relay-test"
+	ch := listener.subscribe(runID)
+	defer listener.unsubscribe(runID, ch)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.run(ctx)
+	}()
+
+	// Large enough to be split into several notifications.
+	frame := []byte(strings.Repeat("x", 2*pgEventChunkSize))
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for received := false; !received; {
+		// Publish until the listener is up; earlier notifications are lost.
+		sender.publish(runEvent{RunID: runID, Seq: 1, Frame: frame})
+		select {
+		case ev := <-ch:
+			if ev.RunID != runID || string(ev.Frame) != string(frame) {
+				t.Fatalf("got event %q with %d byte frame", ev.RunID, len(ev.Frame))
+			}
+			received = true
+		case <-tick.C:
+		case <-ctx.Done():
+			t.Fatal("no event relayed before timeout")
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not stop after cancel")
+	}
+}
@@ -0,0 +1,263 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+// errFetchBlocked marks URLs refused by the fetch policy.
+var errFetchBlocked = errors.New("fetch blocked")
+
+type fetchBlockedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *fetchBlockedError) Error() string {
+	return fmt.Sprintf("fetch blocked: %s (%s)", e.Reason, e.URL)
+}
+
+func (e *fetchBlockedError) Unwrap() error { return errFetchBlocked }
+
+// blockedNets are special-purpose ranges that are never fetched unless
+// explicitly allowed, on top of the loopback/private/link-local checks.
+var blockedNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001:db8::/32",
+)
+
+// fetchPolicy decides which URLs the page fetcher may reach. It resolves
+// host names itself and checks every address, so the model cannot reach
+// internal services, cloud metadata endpoints or loopback.
+//
+// Allow entries (domains or CIDRs) permit hosts that would otherwise be
+// blocked, e.g. an intranet wiki; deny entries always win.
+type fetchPolicy struct {
+	allowHosts []string
+	allowNets  []*net.IPNet
+	denyHosts  []string
+	denyNets   []*net.IPNet
+	resolver   ipResolver
+}
+
+// ipResolver is the part of *net.Resolver the policy uses.
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func newFetchPolicy(cfg config.Config) *fetchPolicy {
+	p := &fetchPolicy{resolver: net.DefaultResolver}
+	p.allowHosts, p.allowNets = splitHostRules(cfg.FetchAllowHosts)
+	p.denyHosts, p.denyNets = splitHostRules(cfg.FetchDenyHosts)
+	return p
+}
+
+func splitHostRules(rules []string) ([]string, []*net.IPNet) {
+	var hosts []string
+	var nets []*net.IPNet
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(rule); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		if ip := net.ParseIP(rule); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		hosts = append(hosts, strings.TrimPrefix(strings.TrimSuffix(rule, "."), "*."))
+	}
+	return hosts, nets
+}
+
+// checkURL validates scheme and host of a URL before it is requested.
+func (p *fetchPolicy) checkURL(ctx context.Context, u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return &fetchBlockedError{URL: u.String(), Reason: "scheme not allowed"}
+	}
+	if u.User != nil {
+		return &fetchBlockedError{URL: u.String(), Reason: "credentials in URL"}
+	}
+	if _, err := p.resolve(ctx, u.Hostname()); err != nil {
+		var blocked *fetchBlockedError
+		if errors.As(err, &blocked) {
+			blocked.URL = u.String()
+		}
+		return err
+	}
+	return nil
+}
+
+// resolve returns the addresses of host that may be dialed.
+func (p *fetchPolicy) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if host == "" {
+		return nil, &fetchBlockedError{Reason: "empty host"}
+	}
+	if matchesDomain(host, p.denyHosts) {
+		return nil, &fetchBlockedError{URL: host, Reason: "host denied"}
+	}
+	allowedByName := matchesDomain(host, p.allowHosts)
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := p.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+
+	// Every address must pass; otherwise a host with one public and one
+	// private record could be used to reach the private one.
+	for _, ip := range ips {
+		if containsIP(p.denyNets, ip) {
+			return nil, &fetchBlockedError{URL: host, Reason: "address denied: " + ip.String()}
+		}
+		if allowedByName || containsIP(p.allowNets, ip) {
+			continue
+		}
+		if reason := blockedIPReason(ip); reason != "" {
+			return nil, &fetchBlockedError{URL: host, Reason: reason + " address " + ip.String()}
+		}
+	}
+	return ips, nil
+}
+
+func blockedIPReason(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	switch {
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsPrivate():
+		return "private"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		// includes 169.254.169.254 cloud metadata
+		return "link-local"
+	case ip.IsUnspecified():
+		return "unspecified"
+	case ip.IsMulticast(), ip.IsInterfaceLocalMulticast():
+		return "multicast"
+	case containsIP(blockedNets, ip):
+		return "reserved"
+	}
+	return ""
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// newFetchClient builds the HTTP client used for reading pages. Connections
+// go only to addresses approved by the policy (DNS is resolved once and the
+// checked address is dialed) and every redirect hop is re-checked, against
+// the space's domain lists too when the request carries one. The
+// environment proxy is not used: it would resolve and connect on our behalf,
+// out of reach of the dial-time check.
+func newFetchClient(cfg config.Config, policy *fetchPolicy) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := &http.Transport{
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			ips, err := policy.resolve(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			var lastErr error
+			for _, ip := range ips {
+				conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+			return nil, lastErr
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	maxRedirects := cfg.FetchMaxRedirects
+	return &http.Client{
+		Timeout:   cfg.FetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if !fetchSpaceFrom(req.Context()).allowsURL(req.URL.String()) {
+				return &fetchBlockedError{URL: req.URL.String(), Reason: "domain excluded in this space"}
+			}
+			return policy.checkURL(req.Context(), req.URL)
+		},
+	}
+}
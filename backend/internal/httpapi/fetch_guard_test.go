@@ -0,0 +1,172 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+// stubResolver answers lookups from a fixed table.
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	out := make([]net.IPAddr, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, net.IPAddr{IP: net.ParseIP(a)})
+	}
+	return out, nil
+}
+
+func testFetchPolicy(allow, deny []string) *fetchPolicy {
+	p := &fetchPolicy{resolver: stubResolver{
+		"public.example":   {"93.184.216.34"},
+		"intranet.example": {"10.1.2.3"},
+		"wiki.corp":        {"10.9.9.9"},
+		"mixed.example":    {"93.184.216.34", "192.168.1.10"},
+		"metadata.example": {"169.254.169.254"},
+	}}
+	p.allowHosts, p.allowNets = splitHostRules(allow)
+	p.denyHosts, p.denyNets = splitHostRules(deny)
+	return p
+}
+
+func TestBlockedIPReason(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"93.184.216.34", ""},
+		{"2606:4700::1111", ""},
+		{"127.0.0.1", "loopback"},
+		{"::1", "loopback"},
+		{"::ffff:127.0.0.1", "loopback"},
+		{"10.0.0.1", "private"},
+		{"172.16.5.4", "private"},
+		{"192.168.0.1", "private"},
+		{"::ffff:192.168.0.1", "private"},
+		{"fd00::1", "private"},
+		{"169.254.169.254", "link-local"},
+		{"fe80::1", "link-local"},
+		{"0.0.0.0", "unspecified"},
+		{"::", "unspecified"},
+		{"239.1.1.1", "multicast"},
+		{"100.64.0.1", "reserved"},
+		{"64:ff9b::a9fe:a9fe", "reserved"},
+		{"2001:db8::1", "reserved"},
+	}
+	for _, tt := range tests {
+		if got := blockedIPReason(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("blockedIPReason(%s) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestFetchPolicyResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		host    string
+		blocked bool
+	}{
+		{name: "public name", host: "public.example"},
+		{name: "public literal", host: "93.184.216.34"},
+		{name: "loopback literal", host: "127.0.0.1", blocked: true},
+		{name: "bracketed v6 loopback", host: "[::1]", blocked: true},
+		{name: "mapped v4 loopback", host: "::ffff:127.0.0.1", blocked: true},
+		{name: "private name", host: "intranet.example", blocked: true},
+		{name: "metadata literal", host: "169.254.169.254", blocked: true},
+		{name: "metadata name", host: "metadata.example", blocked: true},
+		{name: "nat64 metadata", host: "64:ff9b::a9fe:a9fe", blocked: true},
+		{name: "mixed public and private answer", host: "mixed.example", blocked: true},
+		{name: "allowed by name", allow: []string{"corp"}, host: "wiki.corp"},
+		{name: "allowed by wildcard name", allow: []string{"*.corp"}, host: "wiki.corp"},
+		{name: "allowed by cidr", allow: []string{"10.0.0.0/8"}, host: "intranet.example"},
+		{name: "allow does not cover other names", allow: []string{"corp"}, host: "intranet.example", blocked: true},
+		{name: "deny name wins over allow", allow: []string{"corp"}, deny: []string{"wiki.corp"}, host: "wiki.corp", blocked: true},
+		{name: "deny cidr wins over allow", allow: []string{"corp"}, deny: []string{"10.9.0.0/16"}, host: "wiki.corp", blocked: true},
+		{name: "deny public host", deny: []string{"example"}, host: "public.example", blocked: true},
+		{name: "trailing dot and case", deny: []string{"public.example"}, host: "Public.Example.", blocked: true},
+		{name: "empty host", host: "", blocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testFetchPolicy(tt.allow, tt.deny)
+			_, err := p.resolve(context.Background(), tt.host)
+			if tt.blocked {
+				if !errors.Is(err, errFetchBlocked) {
+					t.Fatalf("resolve(%q) err = %v, want blocked", tt.host, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve(%q) err = %v", tt.host, err)
+			}
+		})
+	}
+}
+
+func TestFetchClientChecksRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/self":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		case "/metadata":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		case "/intranet":
+			http.Redirect(w, r, "http://intranet.example/", http.StatusFound)
+		case "/scheme":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/public":
+			http.Redirect(w, r, "http://public.example/", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	// The test server itself listens on loopback, so allow exactly that.
+	policy := testFetchPolicy([]string{"127.0.0.1"}, nil)
+	client := newFetchClient(config.Config{FetchTimeout: 5 * time.Second, FetchMaxRedirects: 3}, policy)
+
+	resp, err := client.Get(srv.URL + "/self")
+	if err != nil {
+		t.Fatalf("allowed redirect: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, path := range []string{"/metadata", "/intranet", "/scheme"} {
+		resp, err := client.Get(srv.URL + path)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, errFetchBlocked) {
+			t.Errorf("redirect via %s: err = %v, want blocked", path, err)
+		}
+	}
+
+	// A space's deny list applies to redirect targets as well.
+	sp := &space{DenyDomains: []string{"public.example"}}
+	req, err := http.NewRequestWithContext(withFetchSpace(context.Background(), sp), http.MethodGet, srv.URL+"/public", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, errFetchBlocked) {
+		t.Errorf("redirect to a domain denied by the space: err = %v, want blocked", err)
+	}
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// pendingStep is a step recorded while a page is read in the background and
+// published later, once every source before it has been published.
+type pendingStep struct {
+	Type    string
+	Title   string
+	Payload map[string]any
+}
+
+type stepBuffer struct {
+	steps []pendingStep
+}
+
+func (b *stepBuffer) add(stepType, title string, payload map[string]any) {
+	b.steps = append(b.steps, pendingStep{Type: stepType, Title: title, Payload: payload})
+}
+
+// readSources fetches sources concurrently, at most FetchConcurrency at a
+// time and FetchPerHost per host across all runs. Each source's page.* steps
+// are buffered and flushed in input order, so the step log reads the same as
+// a sequential fetch; a slow page only holds back the steps after it.
+func (s *Server) readSources(ctx context.Context, runID string, sources []sourceRecord) error {
+	workers := s.cfg.FetchConcurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+
+	buffers := make([]stepBuffer, len(sources))
+	done := make(chan int, len(sources))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				s.readSourceLimited(ctx, runID, &sources[i], &buffers[i])
+				done <- i
+			}
+		}()
+	}
+	go func() {
+		for i := range sources {
+			next <- i
+		}
+		close(next)
+	}()
+
+	finished := make([]bool, len(sources))
+	flushed := 0
+	for range sources {
+		finished[<-done] = true
+		for flushed < len(sources) && finished[flushed] {
+			for _, step := range buffers[flushed].steps {
+				s.publishStep(ctx, runID, step.Type, step.Title, step.Payload)
+			}
+			flushed++
+		}
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Server) readSourceLimited(ctx context.Context, runID string, source *sourceRecord, steps *stepBuffer) {
+	release, err := s.fetchHosts.acquire(ctx, fetchHostKey(source.URL))
+	if err != nil {
+		steps.add("page.fetch.started", "Requesting page", map[string]any{"url": source.URL})
+		s.recordFetchFailure(steps, runID, source.URL, err)
+		return
+	}
+	defer release()
+	s.readSource(ctx, runID, source, steps)
+}
+
+func fetchHostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// hostLimiter caps concurrent requests per host. Slots are created on demand
+// and dropped once no request holds or waits for them.
+type hostLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem  chan struct{}
+	refs int
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, hosts: map[string]*hostSlot{}}
+}
+
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	if l.limit <= 0 || host == "" {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{sem: make(chan struct{}, l.limit)}
+		l.hosts[host] = slot
+	}
+	slot.refs++
+	l.mu.Unlock()
+
+	unref := func() {
+		l.mu.Lock()
+		slot.refs--
+		if slot.refs == 0 {
+			delete(l.hosts, host)
+		}
+		l.mu.Unlock()
+	}
+
+	select {
+	case slot.sem <- struct{}{}:
+	case <-ctx.Done():
+		unref()
+		return nil, context.Cause(ctx)
+	}
+	return func() {
+		<-slot.sem
+		unref()
+	}, nil
+}
@@ -0,0 +1,218 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+// dummyPasswordHash is a bcrypt hash at the default cost that login compares
+// against when the email is unknown, so both failures cost the same time.
+var dummyPasswordHash = []byte("$2a$10$NuiQkxIb11HS6BmVVVpLBeQ1vfi9w4/xu7H0mua.KnnEz7VSIVt7i")
+
+type credentialsReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type userResp struct {
+	ID             string `json:"id"`
+	Email          string `json:"email"`
+	PreferredModel string `json:"preferred_model"`
+}
+
+type authResp struct {
+	tokenPair
+	User userResp `json:"user"`
+}
+
+func toUserResp(u *User) userResp {
+	return userResp{ID: u.ID, Email: u.Email, PreferredModel: u.PreferredModel}
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req credentialsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid email")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		writeErr(w, http.StatusBadRequest, "password is too short")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tx, err := s.pool.Begin(r.Context())
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer func() { _ = tx.Rollback(r.Context()) }()
+
+	user := User{Email: email, PreferredModel: s.cfg.DefaultModel()}
+	err = tx.QueryRow(
+		r.Context(),
+		`insert into users(email, password_hash, preferred_model) values ($1,$2,$3) returning id`,
+		email,
+		string(hash),
+		user.PreferredModel,
+	).Scan(&user.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			writeErr(w, http.StatusConflict, "email already registered")
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pair, _, err := s.issueTokens(r.Context(), tx, user.ID, user.Email)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.logger.Info().Str("user_id", user.ID).Msg("user registered")
+	writeJSON(w, http.StatusCreated, authResp{tokenPair: pair, User: toUserResp(&user)})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req credentialsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var user User
+	var hash string
+	err := s.pool.QueryRow(
+		r.Context(),
+		`select id, email, preferred_model, password_hash from users where email=$1`,
+		email,
+	).Scan(&user.ID, &user.Email, &user.PreferredModel, &hash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err != nil || hash == "" {
+		// Compare anyway, so unknown emails take as long as wrong passwords.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		writeErr(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		writeErr(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+
+	tx, err := s.pool.Begin(r.Context())
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer func() { _ = tx.Rollback(r.Context()) }()
+
+	pair, _, err := s.issueTokens(r.Context(), tx, user.ID, user.Email)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, authResp{tokenPair: pair, User: toUserResp(&user)})
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	refresh := strings.TrimSpace(req.RefreshToken)
+	if refresh == "" {
+		writeErr(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	pair, user, err := s.rotateRefreshToken(r.Context(), refresh)
+	if err != nil {
+		switch {
+		case errors.Is(err, errRefreshTokenReuse):
+			s.logger.Warn().Msg("refresh token reuse detected, user sessions revoked")
+			writeErr(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, errInvalidToken), errors.Is(err, errExpiredToken):
+			writeErr(w, http.StatusUnauthorized, err.Error())
+		default:
+			writeErr(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, authResp{tokenPair: pair, User: toUserResp(user)})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var req refreshReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	refresh := strings.TrimSpace(req.RefreshToken)
+	if refresh == "" {
+		writeErr(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	_, err := s.pool.Exec(
+		r.Context(),
+		`update refresh_tokens set revoked_at=now() where token_hash=$1 and revoked_at is null`,
+		hashRefreshToken(refresh),
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUserResp(user))
+}
@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	chatTitleMaxRunes = 200
+	chatBulkMaxIDs    = 500
+)
+
+// chatPatchReq changes the fields that are set. SpaceID "" takes the chat
+// out of its space.
+type chatPatchReq struct {
+	Title   *string `json:"title"`
+	Pinned  *bool   `json:"pinned"`
+	SpaceID *string `json:"space_id"`
+}
+
+type chatBulkReq struct {
+	IDs    []string `json:"ids"`
+	Action string   `json:"action"`
+	// SpaceID is the target of the move action; "" unfiles the chats.
+	SpaceID string `json:"space_id"`
+}
+
+// handleUpdateChat renames, pins and moves a chat between spaces. Fields left
+// out of the body are kept; a renamed chat no longer gets an automatic title.
+func (s *Server) handleUpdateChat(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	chatID := chi.URLParam(r, "chatID")
+	if chatID == "" {
+		writeErr(w, http.StatusBadRequest, "chatID is required")
+		return
+	}
+
+	var req chatPatchReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Title == nil && req.Pinned == nil && req.SpaceID == nil {
+		writeErr(w, http.StatusBadRequest, "title, pinned or space_id is required")
+		return
+	}
+	if req.SpaceID != nil && *req.SpaceID != "" && !s.checkSpaceParam(w, r, user.ID, *req.SpaceID) {
+		return
+	}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			writeErr(w, http.StatusBadRequest, "title must not be empty")
+			return
+		}
+		if utf8.RuneCountInString(title) > chatTitleMaxRunes {
+			writeErr(w, http.StatusBadRequest, "title is too long")
+			return
+		}
+		req.Title = &title
+	}
+
+	var item chatListItem
+	err := s.pool.QueryRow(
+		r.Context(),
+		`update chats set
+			title=coalesce($3, title),
+			title_edited=title_edited or $3::text is not null,
+			pinned=coalesce($4, pinned),
+			space_id=case when $5::text is null then space_id else nullif($5::text, '')::uuid end
+		 where id=$1 and user_id=$2 and deleted_at is null
+		 returning id, title, pinned, created_at, updated_at,
+			exists(select 1 from bookmarks b where b.chat_id=chats.id and b.user_id=$2), space_id`,
+		chatID,
+		user.ID,
+		req.Title,
+		req.Pinned,
+		req.SpaceID,
+	).Scan(&item.ID, &item.Title, &item.Pinned, &item.CreatedAt, &item.UpdatedAt, &item.Bookmarked, &item.SpaceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeErr(w, http.StatusNotFound, "chat not found")
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+// handleBulkChats applies one action (delete, pin, unpin, bookmark,
+// unbookmark or move to space_id) to several chats. IDs that are not the user's live chats are
+// skipped; affected counts the chats changed.
+func (s *Server) handleBulkChats(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	var req chatBulkReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeErr(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > chatBulkMaxIDs {
+		writeErr(w, http.StatusBadRequest, "too many ids")
+		return
+	}
+	for _, id := range req.IDs {
+		if _, err := uuid.Parse(id); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid id: "+id)
+			return
+		}
+	}
+
+	var sql string
+	args := []any{user.ID, req.IDs}
+	switch req.Action {
+	case "delete":
+		sql = `update chats set deleted_at=now() where id = any($2) and user_id=$1 and deleted_at is null`
+	case "pin":
+		sql = `update chats set pinned=true where id = any($2) and user_id=$1 and deleted_at is null and not pinned`
+	case "unpin":
+		sql = `update chats set pinned=false where id = any($2) and user_id=$1 and deleted_at is null and pinned`
+	case "bookmark":
+		sql = `insert into bookmarks(user_id, chat_id)
+			select $1, id from chats where id = any($2) and user_id=$1 and deleted_at is null
+			on conflict do nothing`
+	case "unbookmark":
+		sql = `delete from bookmarks where chat_id = any($2) and user_id=$1`
+	case "move":
+		if req.SpaceID != "" && !s.checkSpaceParam(w, r, user.ID, req.SpaceID) {
+			return
+		}
+		sql = `update chats set space_id=nullif($3::text, '')::uuid
+			where id = any($2) and user_id=$1 and deleted_at is null and space_id is distinct from nullif($3::text, '')::uuid`
+		args = append(args, req.SpaceID)
+	default:
+		writeErr(w, http.StatusBadRequest, "action must be delete, pin, unpin, bookmark, unbookmark or move")
+		return
+	}
+
+	result, err := s.pool.Exec(r.Context(), sql, args...)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "action": req.Action, "affected": result.RowsAffected()})
+}
+
+// checkSpaceParam writes the error for a space_id that is malformed or not
+// the user's.
+func (s *Server) checkSpaceParam(w http.ResponseWriter, r *http.Request, userID, spaceID string) bool {
+	if _, err := uuid.Parse(spaceID); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid space_id")
+		return false
+	}
+	owned, err := s.userOwnsSpace(r.Context(), userID, spaceID)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !owned {
+		writeErr(w, http.StatusNotFound, "space not found")
+		return false
+	}
+	return true
+}
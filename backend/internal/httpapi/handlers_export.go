@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const chatImportMaxBytes = 32 << 20
+
+// handleExportChat serves a chat as md, json or html. The Markdown and HTML
+// reports show the active branch with its citations as one reference list;
+// the JSON keeps every branch and is what POST /chats/import reads back.
+// trace=1 adds the run steps.
+func (s *Server) handleExportChat(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	chatID := chi.URLParam(r, "chatID")
+	if chatID == "" {
+		writeErr(w, http.StatusBadRequest, "chatID is required")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "md"
+	}
+	if format != "md" && format != "json" && format != "html" {
+		writeErr(w, http.StatusBadRequest, "format must be md, json or html")
+		return
+	}
+	trace, _ := strconv.ParseBool(r.URL.Query().Get("trace"))
+
+	ex, err := s.loadChatExport(r.Context(), user.ID, chatID, trace)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeErr(w, http.StatusNotFound, "chat not found")
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFilename(ex, format)+`"`)
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, ex)
+	case "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(renderChatMarkdown(buildChatReport(ex, trace))))
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := renderChatHTML(w, buildChatReport(ex, trace)); err != nil {
+			s.logger.Warn().Err(err).Str("chat_id", chatID).Msg("render chat export failed")
+		}
+	}
+}
+
+// handleImportChat creates a new chat from a JSON export.
+func (s *Server) handleImportChat(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	var ex chatExport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, chatImportMaxBytes)).Decode(&ex); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeErr(w, http.StatusRequestEntityTooLarge, "export too large")
+			return
+		}
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	chatID, err := s.importChat(r.Context(), user.ID, &ex)
+	if err != nil {
+		if isImportInputErr(err) {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{"chat_id": chatID})
+}
@@ -1,11 +1,14 @@
 package httpapi
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type chatListItem struct {
@@ -13,6 +16,7 @@ type chatListItem struct {
 	Title      string    `json:"title"`
 	Pinned     bool      `json:"pinned"`
 	Bookmarked bool      `json:"bookmarked"`
+	SpaceID    *string   `json:"space_id"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
@@ -22,9 +26,12 @@ type chatMeta struct {
 	Title      string    `json:"title"`
 	Pinned     bool      `json:"pinned"`
 	Bookmarked bool      `json:"bookmarked"`
+	SpaceID    *string   `json:"space_id"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	LastRunID  string    `json:"last_run_id"`
+	// ActiveMessageID is the last message of the branch being shown.
+	ActiveMessageID *string `json:"active_message_id"`
 }
 
 type bookmarkItem struct {
@@ -42,6 +49,13 @@ type messageItem struct {
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
 	RunID     *string   `json:"run_id,omitempty"`
+	// Citations is set on assistant messages; see citation.
+	Citations       json.RawMessage `json:"citations,omitempty"`
+	ParentMessageID *string         `json:"parent_message_id"`
+	// SiblingCount and SiblingIndex place the message among the alternatives
+	// sharing its parent (regenerated answers, edited questions).
+	SiblingCount int `json:"sibling_count"`
+	SiblingIndex int `json:"sibling_index"`
 }
 
 func (s *Server) handleListChats(w http.ResponseWriter, r *http.Request) {
@@ -51,18 +65,29 @@ func (s *Server) handleListChats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// space_id filters by space; "none" lists chats outside any space
+	spaceID := strings.TrimSpace(r.URL.Query().Get("space_id"))
+	if spaceID != "" && spaceID != "none" {
+		if _, err := uuid.Parse(spaceID); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid space_id")
+			return
+		}
+	}
+
 	limit, offset := parseLimitOffset(r, 20, 100)
 	rows, err := s.pool.Query(
 		r.Context(),
-		`select c.id, c.title, c.pinned, c.created_at, c.updated_at, (b.id is not null) as bookmarked
+		`select c.id, c.title, c.pinned, c.created_at, c.updated_at, (b.id is not null) as bookmarked, c.space_id
 		 from chats c
 		 left join bookmarks b on b.chat_id=c.id and b.user_id=$1
 		 where c.user_id=$1 and c.deleted_at is null
+			and ($4 = '' or ($4 = 'none' and c.space_id is null) or c.space_id::text = $4)
 		 order by c.pinned desc, c.updated_at desc
 		 limit $2 offset $3`,
 		user.ID,
 		limit,
 		offset,
+		spaceID,
 	)
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, err.Error())
@@ -73,7 +98,7 @@ func (s *Server) handleListChats(w http.ResponseWriter, r *http.Request) {
 	items := make([]chatListItem, 0, limit)
 	for rows.Next() {
 		var item chatListItem
-		if err := rows.Scan(&item.ID, &item.Title, &item.Pinned, &item.CreatedAt, &item.UpdatedAt, &item.Bookmarked); err != nil {
+		if err := rows.Scan(&item.ID, &item.Title, &item.Pinned, &item.CreatedAt, &item.UpdatedAt, &item.Bookmarked, &item.SpaceID); err != nil {
 			writeErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -99,11 +124,23 @@ func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
 	limit, offset := parseLimitOffset(r, 50, 200)
 	rows, err := s.pool.Query(
 		r.Context(),
-		`select m.id, m.role, m.content, m.created_at, m.run_id
-		 from messages m
-		 join chats c on c.id=m.chat_id
-		 where m.chat_id=$1 and c.user_id=$2 and c.deleted_at is null
-		 order by m.created_at asc
+		`with recursive branch as (
+			select m.id, m.parent_message_id, 0 as depth
+			from messages m
+			join chats c on c.active_message_id=m.id
+			where c.id=$1 and c.user_id=$2 and c.deleted_at is null
+			union all
+			select m.id, m.parent_message_id, b.depth + 1
+			from messages m
+			join branch b on m.id=b.parent_message_id
+		)
+		select m.id, m.role, m.content, m.created_at, m.run_id, m.citations, m.parent_message_id,
+			(select count(*) from messages s where s.chat_id=m.chat_id and s.parent_message_id is not distinct from m.parent_message_id),
+			(select count(*) from messages s where s.chat_id=m.chat_id and s.parent_message_id is not distinct from m.parent_message_id
+				and (s.created_at, s.id) < (m.created_at, m.id))
+		 from branch b
+		 join messages m on m.id=b.id
+		 order by b.depth desc
 		 limit $3 offset $4`,
 		chatID,
 		user.ID,
@@ -119,7 +156,7 @@ func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
 	items := make([]messageItem, 0, limit)
 	for rows.Next() {
 		var item messageItem
-		if err := rows.Scan(&item.ID, &item.Role, &item.Content, &item.CreatedAt, &item.RunID); err != nil {
+		if err := rows.Scan(&item.ID, &item.Role, &item.Content, &item.CreatedAt, &item.RunID, &item.Citations, &item.ParentMessageID, &item.SiblingCount, &item.SiblingIndex); err != nil {
 			writeErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -148,12 +185,13 @@ func (s *Server) handleGetChat(w http.ResponseWriter, r *http.Request) {
 		r.Context(),
 		`select c.id, c.title, c.pinned, c.created_at, c.updated_at,
 			(select r.id from runs r where r.chat_id=c.id order by r.started_at desc limit 1) as last_run_id,
-			(select 1 from bookmarks b where b.chat_id=c.id and b.user_id=$2 limit 1) is not null as bookmarked
+			(select 1 from bookmarks b where b.chat_id=c.id and b.user_id=$2 limit 1) is not null as bookmarked,
+			c.active_message_id, c.space_id
 		 from chats c
 		 where c.id=$1 and c.user_id=$2 and c.deleted_at is null`,
 		chatID,
 		user.ID,
-	).Scan(&item.ID, &item.Title, &item.Pinned, &item.CreatedAt, &item.UpdatedAt, &lastRunID, &item.Bookmarked)
+	).Scan(&item.ID, &item.Title, &item.Pinned, &item.CreatedAt, &item.UpdatedAt, &lastRunID, &item.Bookmarked, &item.ActiveMessageID, &item.SpaceID)
 	if err != nil {
 		writeErr(w, http.StatusNotFound, "chat not found")
 		return
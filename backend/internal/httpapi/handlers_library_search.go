@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// ts_headline marks matches with control characters so the fragment can
+	// be HTML-escaped before the marks become <mark> tags.
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxFragments=2, MaxWords=30, MinWords=12"
+
+	// matches the length the tsvector columns index
+	librarySearchBodyRunes = 100000
+)
+
+var librarySearchKinds = map[string]bool{"chat": true, "message": true, "source": true}
+
+type librarySearchHit struct {
+	Kind      string    `json:"kind"`
+	ChatID    string    `json:"chat_id"`
+	RunID     *string   `json:"run_id,omitempty"`
+	MessageID *string   `json:"message_id,omitempty"`
+	URL       *string   `json:"url,omitempty"`
+	Title     string    `json:"title"`
+	Fragment  string    `json:"fragment"`
+	Rank      float64   `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleLibrarySearch runs a full-text query over the user's chat titles,
+// messages and the pages read in their runs. kind limits the hits to chat,
+// message or source. Fragments are HTML with matches wrapped in <mark>.
+func (s *Server) handleLibrarySearch(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeErr(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	kind := strings.TrimSpace(r.URL.Query().Get("kind"))
+	if kind != "" && !librarySearchKinds[kind] {
+		writeErr(w, http.StatusBadRequest, "kind must be chat, message or source")
+		return
+	}
+
+	limit, offset := parseLimitOffset(r, 20, 100)
+	rows, err := s.pool.Query(
+		r.Context(),
+		`with q as (
+			select websearch_to_tsquery('english', $2) || websearch_to_tsquery('russian', $2) as query
+		),
+		hits as (
+			select 'chat'::text as kind, c.id as chat_id, null::uuid as run_id, null::uuid as message_id, null::text as url,
+				c.title, c.title as body, ts_rank(c.search_tsv, q.query) as rank, c.updated_at as created_at
+			from chats c, q
+			where c.user_id=$1 and c.deleted_at is null and c.search_tsv @@ q.query
+			union all
+			select 'message', m.chat_id, m.run_id, m.id, null,
+				c.title, left(m.content, $3), ts_rank(m.search_tsv, q.query), m.created_at
+			from messages m
+			join chats c on c.id=m.chat_id, q
+			where c.user_id=$1 and c.deleted_at is null and m.search_tsv @@ q.query
+			union all
+			select * from (
+				select distinct on (p.url) 'source'::text, r.chat_id, r.id, null::uuid, p.url,
+					coalesce(nullif(p.title, ''), s.title), left(p.content, $3), ts_rank(p.search_tsv, q.query), s.created_at
+				from page_cache p
+				join sources s on s.url=p.url
+				join runs r on r.id=s.run_id
+				join chats c on c.id=r.chat_id, q
+				where r.user_id=$1 and c.deleted_at is null and p.search_tsv @@ q.query
+				order by p.url, s.created_at desc
+			) src
+		),
+		page as (
+			select * from hits
+			where $4::text = '' or kind = $4::text
+			order by rank desc, created_at desc
+			limit $5 offset $6
+		)
+		select page.kind, page.chat_id, page.run_id, page.message_id, page.url, page.title,
+			case when page.body ~ '[А-Яа-яЁё]'
+				then ts_headline('russian', page.body, q.query, $7)
+				else ts_headline('english', page.body, q.query, $7)
+			end,
+			page.rank, page.created_at
+		 from page, q
+		 order by page.rank desc, page.created_at desc`,
+		user.ID,
+		q,
+		librarySearchBodyRunes,
+		kind,
+		limit,
+		offset,
+		headlineOptions,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	items := make([]librarySearchHit, 0, limit)
+	for rows.Next() {
+		var item librarySearchHit
+		var rank float32
+		if err := rows.Scan(&item.Kind, &item.ChatID, &item.RunID, &item.MessageID, &item.URL, &item.Title, &item.Fragment, &rank, &item.CreatedAt); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		item.Rank = float64(rank)
+		item.Fragment = highlightFragment(item.Fragment)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"q": q, "items": items, "limit": limit, "offset": offset})
+}
+
+func highlightFragment(fragment string) string {
+	escaped := html.EscapeString(normalizeWhitespace(fragment))
+	escaped = strings.ReplaceAll(escaped, headlineStart, "<mark>")
+	return strings.ReplaceAll(escaped, headlineStop, "</mark>")
+}
@@ -0,0 +1,310 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type messageRegenerateReq struct {
+	Model string `json:"model"`
+}
+
+type messageEditReq struct {
+	Query string `json:"query"`
+	Model string `json:"model"`
+}
+
+// branchMessage is a message with its place in the chat's message tree.
+type branchMessage struct {
+	ID       string
+	ChatID   string
+	ParentID *string
+	Role     string
+	Content  string
+	RunModel *string
+}
+
+type siblingItem struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Model     *string   `json:"model,omitempty"`
+	RunID     *string   `json:"run_id,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Server) loadBranchMessage(ctx context.Context, userID, messageID string) (branchMessage, error) {
+	var m branchMessage
+	err := s.pool.QueryRow(
+		ctx,
+		`select m.id, m.chat_id, m.parent_message_id, m.role, m.content, r.model
+		 from messages m
+		 join chats c on c.id=m.chat_id
+		 left join runs r on r.id=m.run_id
+		 where m.id=$1 and c.user_id=$2 and c.deleted_at is null`,
+		messageID,
+		userID,
+	).Scan(&m.ID, &m.ChatID, &m.ParentID, &m.Role, &m.Content, &m.RunModel)
+	return m, err
+}
+
+// handleRegenerateMessage answers a user message again, as a new sibling of
+// its existing answers. The message may be the user message or one of the
+// answers to it; the model defaults to the one that wrote that answer.
+func (s *Server) handleRegenerateMessage(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	messageID := chi.URLParam(r, "messageID")
+	if messageID == "" {
+		writeErr(w, http.StatusBadRequest, "messageID is required")
+		return
+	}
+
+	var req messageRegenerateReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+	}
+
+	msg, err := s.loadBranchMessage(r.Context(), user.ID, messageID)
+	if err != nil {
+		writeMessageLoadErr(w, err)
+		return
+	}
+	prevModel := ""
+	if msg.Role == "assistant" {
+		if msg.RunModel != nil {
+			prevModel = *msg.RunModel
+		}
+		if msg.ParentID == nil {
+			writeErr(w, http.StatusConflict, "answer has no question to regenerate")
+			return
+		}
+		if msg, err = s.loadBranchMessage(r.Context(), user.ID, *msg.ParentID); err != nil {
+			writeMessageLoadErr(w, err)
+			return
+		}
+	}
+	if msg.Role != "user" {
+		writeErr(w, http.StatusConflict, "only user messages can be answered")
+		return
+	}
+
+	if prevModel == "" {
+		prevModel = s.spaceDefaultModel(r.Context(), user.ID, msg.ChatID, "")
+	}
+	model, ok := s.resolveRunModel(user, req.Model, prevModel)
+	if !ok {
+		writeErr(w, http.StatusBadRequest, "unknown model")
+		return
+	}
+
+	run := queuedRun{
+		RunID:     uuid.New().String(),
+		ChatID:    msg.ChatID,
+		UserID:    user.ID,
+		Model:     model,
+		Query:     msg.Content,
+		MessageID: msg.ID,
+	}
+	if err := s.createQueuedRun(r.Context(), &run); err != nil {
+		s.writeRunCreateErr(w, user, err)
+		return
+	}
+
+	s.logger.Info().Str("run_id", run.RunID).Str("chat_id", run.ChatID).Str("message_id", msg.ID).Str("model", model).Msg("regenerate queued")
+	s.wakeWorkers()
+
+	writeJSON(w, http.StatusOK, runStartResp{ChatID: run.ChatID, RunID: run.RunID, MessageID: run.MessageID})
+}
+
+// handleEditMessage stores an edited copy of a user message next to the
+// original and answers it; the original branch is kept.
+func (s *Server) handleEditMessage(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	messageID := chi.URLParam(r, "messageID")
+	if messageID == "" {
+		writeErr(w, http.StatusBadRequest, "messageID is required")
+		return
+	}
+
+	var req messageEditReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	q := strings.TrimSpace(req.Query)
+	if q == "" {
+		writeErr(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	msg, err := s.loadBranchMessage(r.Context(), user.ID, messageID)
+	if err != nil {
+		writeMessageLoadErr(w, err)
+		return
+	}
+	if msg.Role != "user" {
+		writeErr(w, http.StatusConflict, "only user messages can be edited")
+		return
+	}
+
+	model, ok := s.resolveRunModel(user, req.Model, s.spaceDefaultModel(r.Context(), user.ID, msg.ChatID, ""))
+	if !ok {
+		writeErr(w, http.StatusBadRequest, "unknown model")
+		return
+	}
+
+	run := queuedRun{
+		RunID:      uuid.New().String(),
+		ChatID:     msg.ChatID,
+		UserID:     user.ID,
+		Model:      model,
+		Query:      q,
+		ParentID:   msg.ParentID,
+		NewMessage: true,
+	}
+	if err := s.createQueuedRun(r.Context(), &run); err != nil {
+		s.writeRunCreateErr(w, user, err)
+		return
+	}
+
+	s.logger.Info().Str("run_id", run.RunID).Str("chat_id", run.ChatID).Str("edited_id", msg.ID).Str("model", model).Msg("edit queued")
+	s.wakeWorkers()
+
+	writeJSON(w, http.StatusOK, runStartResp{ChatID: run.ChatID, RunID: run.RunID, MessageID: run.MessageID})
+}
+
+// handleListSiblings lists the alternatives to a message: the messages with
+// the same parent, oldest first, marking the one on the active branch.
+func (s *Server) handleListSiblings(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	messageID := chi.URLParam(r, "messageID")
+	if messageID == "" {
+		writeErr(w, http.StatusBadRequest, "messageID is required")
+		return
+	}
+
+	msg, err := s.loadBranchMessage(r.Context(), user.ID, messageID)
+	if err != nil {
+		writeMessageLoadErr(w, err)
+		return
+	}
+
+	rows, err := s.pool.Query(
+		r.Context(),
+		`with recursive active as (
+			select m.id, m.parent_message_id
+			from messages m
+			join chats c on c.active_message_id=m.id
+			where c.id=$1
+			union all
+			select m.id, m.parent_message_id
+			from messages m
+			join active a on m.id=a.parent_message_id
+		)
+		select m.id, m.role, m.content, r.model, m.run_id, m.id in (select id from active), m.created_at
+		 from messages m
+		 left join runs r on r.id=m.run_id
+		 where m.chat_id=$1 and m.parent_message_id is not distinct from $2
+		 order by m.created_at asc, m.id asc`,
+		msg.ChatID,
+		msg.ParentID,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	items := []siblingItem{}
+	for rows.Next() {
+		var item siblingItem
+		if err := rows.Scan(&item.ID, &item.Role, &item.Content, &item.Model, &item.RunID, &item.Active, &item.CreatedAt); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		items = append(items, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"parent_message_id": msg.ParentID, "items": items})
+}
+
+// handleActivateMessage switches the chat to the branch through a message,
+// continuing down to its most recent descendant.
+func (s *Server) handleActivateMessage(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	messageID := chi.URLParam(r, "messageID")
+	if messageID == "" {
+		writeErr(w, http.StatusBadRequest, "messageID is required")
+		return
+	}
+
+	msg, err := s.loadBranchMessage(r.Context(), user.ID, messageID)
+	if err != nil {
+		writeMessageLoadErr(w, err)
+		return
+	}
+
+	leaf := msg.ID
+	for {
+		var child string
+		err := s.pool.QueryRow(
+			r.Context(),
+			`select id from messages where parent_message_id=$1 order by created_at desc, id desc limit 1`,
+			leaf,
+		).Scan(&child)
+		if errors.Is(err, pgx.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		leaf = child
+	}
+
+	if _, err := s.pool.Exec(r.Context(), `update chats set active_message_id=$2 where id=$1`, msg.ChatID, leaf); err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"chat_id": msg.ChatID, "active_message_id": leaf})
+}
+
+func writeMessageLoadErr(w http.ResponseWriter, err error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeErr(w, http.StatusNotFound, "message not found")
+		return
+	}
+	writeErr(w, http.StatusInternalServerError, err.Error())
+}
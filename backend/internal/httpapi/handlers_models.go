@@ -1,9 +1,34 @@
 package httpapi
 
-import "net/http"
+import (
+	"net/http"
 
+	"gosearch-ai/backend/internal/config"
+)
+
+type modelResp struct {
+	ID            string              `json:"id"`
+	Provider      string              `json:"provider"`
+	ContextLength int                 `json:"context_length,omitempty"`
+	Capabilities  config.Capabilities `json:"capabilities"`
+}
+
+// handleListModels lists the models of every configured provider. `models`
+// keeps the plain id list older clients read; `items` carries the details.
 func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
+	ids := make([]string, 0, len(s.cfg.Models))
+	items := make([]modelResp, 0, len(s.cfg.Models))
+	for _, m := range s.cfg.Models {
+		ids = append(ids, m.ID)
+		items = append(items, modelResp{
+			ID:            m.ID,
+			Provider:      m.Provider,
+			ContextLength: m.ContextLength,
+			Capabilities:  m.Capabilities,
+		})
+	}
 	writeJSON(w, http.StatusOK, map[string]any{
-		"models": s.cfg.OpenRouterModels,
+		"models": ids,
+		"items":  items,
 	})
 }
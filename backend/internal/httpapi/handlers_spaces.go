@@ -0,0 +1,222 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type spaceItem struct {
+	space
+	ChatCount int       `json:"chat_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const spaceItemQuery = `select ` + spaceColumns + `,
+	(select count(*) from chats c where c.space_id=s.id and c.deleted_at is null),
+	s.created_at, s.updated_at
+ from spaces s`
+
+func (s *Server) handleListSpaces(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	rows, err := s.pool.Query(r.Context(), spaceItemQuery+` where s.user_id=$1 order by s.name asc`, user.ID)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	items := []spaceItem{}
+	for rows.Next() {
+		var item spaceItem
+		if err := scanSpace(rows, &item.space, &item.ChatCount, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		items = append(items, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetSpace(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	spaceID := chi.URLParam(r, "spaceID")
+	if spaceID == "" {
+		writeErr(w, http.StatusBadRequest, "spaceID is required")
+		return
+	}
+
+	item, err := s.loadSpaceItem(r, user.ID, spaceID)
+	if err != nil {
+		writeSpaceLoadErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (s *Server) handleCreateSpace(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	var sp space
+	if err := json.NewDecoder(r.Body).Decode(&sp); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if err := sp.validate(s); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var spaceID string
+	err := s.pool.QueryRow(
+		r.Context(),
+		`insert into spaces(user_id, name, instructions, default_model, search_provider, search_category, allow_domains, deny_domains)
+		 values ($1,$2,$3,$4,$5,$6,$7,$8) returning id`,
+		user.ID,
+		sp.Name,
+		sp.Instructions,
+		sp.DefaultModel,
+		sp.SearchProvider,
+		sp.SearchCategory,
+		sp.AllowDomains,
+		sp.DenyDomains,
+	).Scan(&spaceID)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	item, err := s.loadSpaceItem(r, user.ID, spaceID)
+	if err != nil {
+		writeSpaceLoadErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, item)
+}
+
+// handleUpdateSpace changes the fields present in the body and keeps the
+// rest.
+func (s *Server) handleUpdateSpace(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	spaceID := chi.URLParam(r, "spaceID")
+	if spaceID == "" {
+		writeErr(w, http.StatusBadRequest, "spaceID is required")
+		return
+	}
+
+	item, err := s.loadSpaceItem(r, user.ID, spaceID)
+	if err != nil {
+		writeSpaceLoadErr(w, err)
+		return
+	}
+	sp := item.space
+	if err := json.NewDecoder(r.Body).Decode(&sp); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	sp.ID = spaceID
+	if err := sp.validate(s); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = s.pool.Exec(
+		r.Context(),
+		`update spaces set name=$3, instructions=$4, default_model=$5, search_provider=$6, search_category=$7,
+			allow_domains=$8, deny_domains=$9, updated_at=now()
+		 where id=$1 and user_id=$2`,
+		spaceID,
+		user.ID,
+		sp.Name,
+		sp.Instructions,
+		sp.DefaultModel,
+		sp.SearchProvider,
+		sp.SearchCategory,
+		sp.AllowDomains,
+		sp.DenyDomains,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	item, err = s.loadSpaceItem(r, user.ID, spaceID)
+	if err != nil {
+		writeSpaceLoadErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// handleDeleteSpace removes the space; its chats stay, unfiled.
+func (s *Server) handleDeleteSpace(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	spaceID := chi.URLParam(r, "spaceID")
+	if spaceID == "" {
+		writeErr(w, http.StatusBadRequest, "spaceID is required")
+		return
+	}
+
+	result, err := s.pool.Exec(r.Context(), `delete from spaces where id=$1 and user_id=$2`, spaceID, user.ID)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeErr(w, http.StatusNotFound, "space not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Server) loadSpaceItem(r *http.Request, userID, spaceID string) (spaceItem, error) {
+	var item spaceItem
+	err := scanSpace(
+		s.pool.QueryRow(r.Context(), spaceItemQuery+` where s.id=$1 and s.user_id=$2`, spaceID, userID),
+		&item.space,
+		&item.ChatCount,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+	)
+	return item, err
+}
+
+func writeSpaceLoadErr(w http.ResponseWriter, err error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeErr(w, http.StatusNotFound, "space not found")
+		return
+	}
+	writeErr(w, http.StatusInternalServerError, err.Error())
+}
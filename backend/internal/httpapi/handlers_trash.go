@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type trashItem struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+func (s *Server) handleListTrash(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	limit, offset := parseLimitOffset(r, 20, 100)
+	rows, err := s.pool.Query(
+		r.Context(),
+		`select id, title, created_at, deleted_at
+		 from chats
+		 where user_id=$1 and deleted_at is not null
+		 order by deleted_at desc
+		 limit $2 offset $3`,
+		user.ID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	items := make([]trashItem, 0, limit)
+	for rows.Next() {
+		var item trashItem
+		if err := rows.Scan(&item.ID, &item.Title, &item.CreatedAt, &item.DeletedAt); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if s.cfg.TrashRetention > 0 {
+			purgeAt := item.DeletedAt.Add(s.cfg.TrashRetention)
+			item.PurgeAt = &purgeAt
+		}
+		items = append(items, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit, "offset": offset})
+}
+
+func (s *Server) handleRestoreChat(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	chatID := chi.URLParam(r, "chatID")
+	if chatID == "" {
+		writeErr(w, http.StatusBadRequest, "chatID is required")
+		return
+	}
+
+	result, err := s.pool.Exec(
+		r.Context(),
+		`update chats set deleted_at = null where id=$1 and user_id=$2 and deleted_at is not null`,
+		chatID,
+		user.ID,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeErr(w, http.StatusNotFound, "chat not found in trash")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handlePurgeChat permanently deletes a chat from the trash. Chats with a
+// queued or running run are refused until the run ends.
+func (s *Server) handlePurgeChat(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	chatID := chi.URLParam(r, "chatID")
+	if chatID == "" {
+		writeErr(w, http.StatusBadRequest, "chatID is required")
+		return
+	}
+
+	var active bool
+	err := s.pool.QueryRow(
+		r.Context(),
+		`select exists(select 1 from runs where chat_id=$1 and user_id=$2 and status in ('queued','running'))`,
+		chatID,
+		user.ID,
+	).Scan(&active)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if active {
+		writeErr(w, http.StatusConflict, "chat has an active run")
+		return
+	}
+
+	result, err := s.pool.Exec(
+		r.Context(),
+		`delete from chats where id=$1 and user_id=$2 and deleted_at is not null`,
+		chatID,
+		user.ID,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeErr(w, http.StatusNotFound, "chat not found in trash")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
@@ -0,0 +1,245 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type modelUsage struct {
+	Model    string `json:"model"`
+	Provider string `json:"provider"`
+	usageTotals
+}
+
+type llmCallItem struct {
+	ID               string    `json:"id"`
+	Model            string    `json:"model"`
+	Provider         string    `json:"provider"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	ReasoningTokens  int       `json:"reasoning_tokens"`
+	CachedTokens     int       `json:"cached_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Cost             float64   `json:"cost"`
+	Estimated        bool      `json:"estimated"`
+	LatencyMS        int       `json:"latency_ms"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (s *Server) handleRunUsage(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	runID := chi.URLParam(r, "runID")
+	if runID == "" {
+		writeErr(w, http.StatusBadRequest, "runID is required")
+		return
+	}
+
+	var total usageTotals
+	err := s.pool.QueryRow(
+		r.Context(),
+		`select prompt_tokens, completion_tokens, reasoning_tokens, total_tokens, cost,
+			(select count(*) from llm_calls where run_id=runs.id)
+		 from runs where id=$1 and user_id=$2`,
+		runID,
+		user.ID,
+	).Scan(&total.PromptTokens, &total.CompletionTokens, &total.ReasoningTokens, &total.TotalTokens, &total.Cost, &total.Calls)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeErr(w, http.StatusNotFound, "run not found")
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	byModel, err := s.usageByModel(r.Context(), `run_id=$1`, runID)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := s.pool.Query(
+		r.Context(),
+		`select id, model, provider, prompt_tokens, completion_tokens, reasoning_tokens, cached_tokens, total_tokens, cost, estimated, latency_ms, created_at
+		 from llm_calls where run_id=$1
+		 order by created_at asc`,
+		runID,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	calls := []llmCallItem{}
+	for rows.Next() {
+		var item llmCallItem
+		if err := rows.Scan(&item.ID, &item.Model, &item.Provider, &item.PromptTokens, &item.CompletionTokens, &item.ReasoningTokens, &item.CachedTokens, &item.TotalTokens, &item.Cost, &item.Estimated, &item.LatencyMS, &item.CreatedAt); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		calls = append(calls, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"run_id":   runID,
+		"total":    total.rounded(),
+		"by_model": byModel,
+		"calls":    calls,
+	})
+}
+
+// handleMyUsage sums the user's LLM usage between from and to (RFC 3339 or
+// YYYY-MM-DD; the last 30 days by default), overall, per model and per day.
+func (s *Server) handleMyUsage(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	now := time.Now().UTC()
+	from, err := parseTimeParam(r.URL.Query().Get("from"), now.AddDate(0, 0, -30), false)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+	to, err := parseTimeParam(r.URL.Query().Get("to"), now, true)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+	if !to.After(from) {
+		writeErr(w, http.StatusBadRequest, "to must be after from")
+		return
+	}
+
+	byModel, err := s.usageByModel(r.Context(), `user_id=$1 and created_at >= $2 and created_at < $3`, user.ID, from, to)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var total usageTotals
+	for _, m := range byModel {
+		total.Calls += m.Calls
+		total.PromptTokens += m.PromptTokens
+		total.CompletionTokens += m.CompletionTokens
+		total.ReasoningTokens += m.ReasoningTokens
+		total.TotalTokens += m.TotalTokens
+		total.Cost += m.Cost
+	}
+
+	var runs int
+	if err := s.pool.QueryRow(
+		r.Context(),
+		`select count(distinct run_id) from llm_calls where user_id=$1 and created_at >= $2 and created_at < $3`,
+		user.ID,
+		from,
+		to,
+	).Scan(&runs); err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := s.pool.Query(
+		r.Context(),
+		`select date_trunc('day', created_at at time zone 'UTC')::date, count(*), sum(total_tokens), sum(cost)
+		 from llm_calls
+		 where user_id=$1 and created_at >= $2 and created_at < $3
+		 group by 1 order by 1`,
+		user.ID,
+		from,
+		to,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type dayUsage struct {
+		Day         string  `json:"day"`
+		Calls       int     `json:"calls"`
+		TotalTokens int64   `json:"total_tokens"`
+		Cost        float64 `json:"cost"`
+	}
+	days := []dayUsage{}
+	for rows.Next() {
+		var item dayUsage
+		var day time.Time
+		if err := rows.Scan(&day, &item.Calls, &item.TotalTokens, &item.Cost); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		item.Day = day.Format("2006-01-02")
+		item.Cost = roundCost(item.Cost)
+		days = append(days, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from":     from,
+		"to":       to,
+		"runs":     runs,
+		"total":    total.rounded(),
+		"by_model": byModel,
+		"by_day":   days,
+	})
+}
+
+func (s *Server) usageByModel(ctx context.Context, where string, args ...any) ([]modelUsage, error) {
+	rows, err := s.pool.Query(
+		ctx,
+		`select model, provider, count(*), sum(prompt_tokens), sum(completion_tokens), sum(reasoning_tokens), sum(total_tokens), sum(cost)
+		 from llm_calls
+		 where `+where+`
+		 group by model, provider
+		 order by sum(cost) desc, sum(total_tokens) desc`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []modelUsage{}
+	for rows.Next() {
+		var item modelUsage
+		if err := rows.Scan(&item.Model, &item.Provider, &item.Calls, &item.PromptTokens, &item.CompletionTokens, &item.ReasoningTokens, &item.TotalTokens, &item.Cost); err != nil {
+			return nil, err
+		}
+		item.Cost = roundCost(item.Cost)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// parseTimeParam accepts RFC 3339 or a plain date. A plain date used as an
+// upper bound covers that whole day.
+func parseTimeParam(raw string, def time.Time, endOfDay bool) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
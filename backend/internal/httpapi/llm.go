@@ -0,0 +1,295 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+// LLMProvider is a chat completion backend. Implementations only encode the
+// request for their API and return the response body; streaming, tool calls
+// and retries of broken streams are handled once in chatToolStep.
+type LLMProvider interface {
+	Name() string
+	// ChatCompletion sends req and returns the body of a 2xx response: an SSE
+	// stream of chunks when req.Stream is set, a single completion otherwise.
+	ChatCompletion(ctx context.Context, req llmRequest) (io.ReadCloser, error)
+}
+
+type llmRequest struct {
+	Model     string
+	Messages  []map[string]any
+	Tools     []map[string]any
+	Stream    bool
+	Reasoning bool
+	// ToolChoice is passed through as tool_choice when set.
+	ToolChoice any
+}
+
+// LLMProviderFactory builds a provider for one providers: entry of config.yaml.
+type LLMProviderFactory func(cfg config.Config, provider config.ProviderConfig) (LLMProvider, error)
+
+var (
+	llmProvidersMu sync.RWMutex
+	llmProviders   = map[string]LLMProviderFactory{}
+)
+
+// RegisterLLMProvider makes a provider type usable as `type:` in config.yaml.
+// Types are case-insensitive; registering a type twice panics.
+func RegisterLLMProvider(factory LLMProviderFactory, types ...string) {
+	llmProvidersMu.Lock()
+	defer llmProvidersMu.Unlock()
+	for _, typ := range types {
+		key := strings.ToLower(strings.TrimSpace(typ))
+		if _, dup := llmProviders[key]; dup {
+			panic("llm provider registered twice: " + key)
+		}
+		llmProviders[key] = factory
+	}
+}
+
+func lookupLLMProvider(typ string) (LLMProviderFactory, bool) {
+	llmProvidersMu.RLock()
+	defer llmProvidersMu.RUnlock()
+	factory, ok := llmProviders[strings.ToLower(strings.TrimSpace(typ))]
+	return factory, ok
+}
+
+func llmProviderTypes() []string {
+	llmProvidersMu.RLock()
+	defer llmProvidersMu.RUnlock()
+	types := make([]string, 0, len(llmProviders))
+	for typ := range llmProviders {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// llmProvider returns the provider serving model along with the model's
+// configuration.
+func (s *Server) llmProvider(model string) (LLMProvider, config.ModelConfig, error) {
+	mc, ok := s.cfg.Model(model)
+	if !ok {
+		return nil, config.ModelConfig{}, fmt.Errorf("unknown model: %s", model)
+	}
+	for _, pc := range s.cfg.Providers {
+		if pc.Name != mc.Provider {
+			continue
+		}
+		factory, ok := lookupLLMProvider(pc.Type)
+		if !ok {
+			return nil, mc, fmt.Errorf("provider %s: unknown type %s (available: %s)", pc.Name, pc.Type, strings.Join(llmProviderTypes(), ", "))
+		}
+		provider, err := factory(s.cfg, pc)
+		return provider, mc, err
+	}
+	return nil, mc, fmt.Errorf("model %s: provider %s is not configured", model, mc.Provider)
+}
+
+// chatToolStep runs one completion of the agent loop. Streamed answer text is
+// published as it arrives; a broken stream is retried only while nothing has
+// reached the client yet.
+func (s *Server) chatToolStep(ctx context.Context, runID, model string, messages []map[string]any, tools []map[string]any, toolChoice any) (toolStepResponse, error) {
+	if strings.TrimSpace(model) == "" {
+		model = s.cfg.DefaultModel()
+	}
+	provider, mc, err := s.llmProvider(model)
+	if err != nil {
+		return toolStepResponse{}, err
+	}
+
+	req := llmRequest{
+		Model:     model,
+		Messages:  messages,
+		Stream:    mc.Capabilities.Streaming,
+		Reasoning: mc.Capabilities.Reasoning,
+	}
+	if mc.Capabilities.Tools {
+		req.Tools = tools
+		req.ToolChoice = toolChoice
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= s.cfg.OpenRouterRetries; attempt++ {
+		started := time.Now()
+		body, err := provider.ChatCompletion(ctx, req)
+		if err != nil {
+			return toolStepResponse{}, err
+		}
+		if !req.Stream {
+			out, err := decodeChatCompletion(body)
+			_ = body.Close()
+			if err != nil {
+				return toolStepResponse{}, fmt.Errorf("%s: %w", provider.Name(), err)
+			}
+			s.recordStepUsage(ctx, runID, model, provider.Name(), messages, out, time.Since(started))
+			return out, nil
+		}
+
+		deltas := newDeltaBatcher(func(delta string) { s.publishAnswerDelta(runID, delta) })
+		streamer := newAnswerStreamer(
+			deltas.add,
+			func() {
+				deltas.discard()
+				s.publishAnswerReset(runID)
+			},
+		)
+		err = streamer.consume(body)
+		_ = body.Close()
+		deltas.flush()
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", provider.Name(), err)
+			if !streamer.streamed() && attempt < s.cfg.OpenRouterRetries && ctx.Err() == nil {
+				continue
+			}
+			return toolStepResponse{Streamed: streamer.streamed()}, lastErr
+		}
+		out := streamer.response()
+		out.Streamed = streamer.streamed()
+		s.recordStepUsage(ctx, runID, model, provider.Name(), messages, out, time.Since(started))
+		if strings.TrimSpace(out.Content) == "" && len(out.ToolCalls) == 0 {
+			return toolStepResponse{}, fmt.Errorf("%s: empty response", provider.Name())
+		}
+		return out, nil
+	}
+	return toolStepResponse{}, lastErr
+}
+
+func (s *Server) recordStepUsage(ctx context.Context, runID, model, provider string, messages []map[string]any, out toolStepResponse, latency time.Duration) {
+	if out.Usage != nil {
+		s.recordLLMCall(ctx, runID, model, provider, *out.Usage, false, latency)
+		return
+	}
+	s.recordLLMCall(ctx, runID, model, provider, estimateUsage(messages, out), true, latency)
+}
+
+// modelChain is the model a run is using and the fallbacks still untried.
+type modelChain struct {
+	current string
+	next    []string
+}
+
+// newModelChain starts at model and continues with its configured fallbacks.
+// Fallbacks that differ in tool support are skipped, since the conversation
+// and system prompt were built for the first model.
+func (s *Server) newModelChain(model string) *modelChain {
+	chain := &modelChain{current: model}
+	mc, ok := s.cfg.Model(model)
+	if !ok {
+		return chain
+	}
+	for _, id := range mc.Fallbacks {
+		if next, ok := s.cfg.Model(id); ok && next.Capabilities.Tools == mc.Capabilities.Tools {
+			chain.next = append(chain.next, id)
+		}
+	}
+	return chain
+}
+
+func (c *modelChain) advance() bool {
+	if len(c.next) == 0 {
+		return false
+	}
+	c.current, c.next = c.next[0], c.next[1:]
+	return true
+}
+
+// chatWithFallback fits the conversation to the current model and runs one
+// completion. When the provider fails, the run moves on to the next model of
+// the chain for good, recording a model.fallback step and the new runs.model.
+func (s *Server) chatWithFallback(ctx context.Context, runID string, chain *modelChain, w *contextWindow, tools []map[string]any, toolChoice any) (toolStepResponse, error) {
+	for {
+		s.fitContext(ctx, runID, chain.current, w, tools)
+		resp, err := s.chatToolStep(ctx, runID, chain.current, w.messages, tools, toolChoice)
+		if err == nil || ctx.Err() != nil {
+			return resp, err
+		}
+		from := chain.current
+		if !chain.advance() {
+			return resp, err
+		}
+		if resp.Streamed {
+			s.publishAnswerReset(runID)
+		}
+		s.logger.Warn().Err(err).Str("run_id", runID).Str("from", from).Str("to", chain.current).Msg("model fallback")
+		s.publishStep(ctx, runID, "model.fallback", "Switching model", map[string]any{
+			"from":  from,
+			"to":    chain.current,
+			"error": err.Error(),
+		})
+		if _, err := s.pool.Exec(ctx, `update runs set model=$2 where id=$1`, runID, chain.current); err != nil {
+			s.logger.Warn().Err(err).Str("run_id", runID).Msg("update run model failed")
+		}
+	}
+}
+
+// chatCompletion is a non-streaming OpenAI-style completion.
+type chatCompletion struct {
+	Choices []struct {
+		Message struct {
+			Content   string     `json:"content"`
+			Reasoning string     `json:"reasoning"`
+			ToolCalls []toolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage *llmUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func decodeChatCompletion(body io.Reader) (toolStepResponse, error) {
+	var resp chatCompletion
+	if err := json.NewDecoder(io.LimitReader(body, 8*1024*1024)).Decode(&resp); err != nil {
+		return toolStepResponse{}, err
+	}
+	if resp.Error != nil {
+		return toolStepResponse{}, errors.New(resp.Error.Message)
+	}
+	if len(resp.Choices) == 0 {
+		return toolStepResponse{}, errors.New("empty response")
+	}
+	msg := resp.Choices[0].Message
+	if strings.TrimSpace(msg.Content) == "" && len(msg.ToolCalls) == 0 {
+		return toolStepResponse{}, errors.New("empty response")
+	}
+	return toolStepResponse{
+		Content:   msg.Content,
+		ToolCalls: msg.ToolCalls,
+		Reasoning: strings.TrimSpace(msg.Reasoning),
+		Usage:     resp.Usage,
+	}, nil
+}
+
+// shouldRetryLLM reports whether a failed completion request may be resent.
+func shouldRetryLLM(err error, status int) bool {
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		if strings.Contains(strings.ToLower(err.Error()), "context deadline exceeded") {
+			return true
+		}
+		if strings.Contains(strings.ToLower(err.Error()), "timeout") {
+			return true
+		}
+		return false
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusRequestTimeout {
+		return true
+	}
+	if status >= 500 && status <= 599 {
+		return true
+	}
+	return false
+}
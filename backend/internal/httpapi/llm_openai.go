@@ -0,0 +1,142 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+func init() {
+	RegisterLLMProvider(newOpenAIProvider, "openai", "openrouter")
+}
+
+// openAIProvider talks to any OpenAI-compatible /chat/completions endpoint:
+// OpenRouter, Ollama, vLLM, llama.cpp server and the like. The openrouter
+// type adds OpenRouter's attribution headers and reasoning parameter.
+type openAIProvider struct {
+	name            string
+	openRouter      bool
+	baseURL         string
+	apiKey          string
+	appURL          string
+	reasoningEffort string
+	retries         int
+	retryDelay      time.Duration
+	client          *http.Client
+}
+
+func newOpenAIProvider(cfg config.Config, pc config.ProviderConfig) (LLMProvider, error) {
+	if strings.TrimSpace(pc.BaseURL) == "" {
+		return nil, fmt.Errorf("provider %s: base_url is required", pc.Name)
+	}
+	return &openAIProvider{
+		name:            pc.Name,
+		openRouter:      pc.Type == "openrouter",
+		baseURL:         strings.TrimRight(pc.BaseURL, "/"),
+		apiKey:          pc.APIKey,
+		appURL:          cfg.BaseURL,
+		reasoningEffort: pc.ReasoningEffort,
+		retries:         pc.Retries,
+		retryDelay:      pc.RetryDelay,
+		client:          &http.Client{Timeout: pc.Timeout},
+	}, nil
+}
+
+func (p *openAIProvider) Name() string { return p.name }
+
+func (p *openAIProvider) body(req llmRequest) map[string]any {
+	body := map[string]any{
+		"model":    req.Model,
+		"stream":   req.Stream,
+		"messages": req.Messages,
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = req.Tools
+		if req.ToolChoice != nil {
+			body["tool_choice"] = req.ToolChoice
+		}
+	}
+	// ask for the usage block; streams only carry it when requested
+	if p.openRouter {
+		body["usage"] = map[string]any{"include": true}
+	} else if req.Stream {
+		body["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if req.Reasoning {
+		if p.openRouter {
+			body["reasoning"] = map[string]any{
+				"effort":  p.reasoningEffort,
+				"exclude": false,
+			}
+		} else {
+			body["reasoning_effort"] = p.reasoningEffort
+		}
+	}
+	return body
+}
+
+// ChatCompletion posts the request and returns the body once a 2xx status
+// arrives. Connection errors and retryable statuses are retried before any
+// body is consumed.
+func (p *openAIProvider) ChatCompletion(ctx context.Context, req llmRequest) (io.ReadCloser, error) {
+	payload, err := json.Marshal(p.body(req))
+	if err != nil {
+		return nil, err
+	}
+	reqURL := p.baseURL + "/chat/completions"
+
+	var lastErr error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(p.retryDelay):
+			}
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if p.apiKey != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if req.Stream {
+			httpReq.Header.Set("Accept", "text/event-stream")
+		}
+		if p.openRouter {
+			httpReq.Header.Set("HTTP-Referer", p.appURL)
+			httpReq.Header.Set("X-Title", "gosearch-ai")
+		}
+
+		resp, err := p.client.Do(httpReq)
+		if err != nil {
+			lastErr = err
+			if shouldRetryLLM(err, 0) && attempt < p.retries {
+				continue
+			}
+			return nil, err
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+			_ = resp.Body.Close()
+			lastErr = fmt.Errorf("%s status %d: %s", p.name, resp.StatusCode, strings.TrimSpace(string(body)))
+			if shouldRetryLLM(nil, resp.StatusCode) && attempt < p.retries {
+				continue
+			}
+			return nil, lastErr
+		}
+		return resp.Body, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,251 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// chatCompletionChunk is one OpenAI-style `chat.completion.chunk` frame.
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			Reasoning        string `json:"reasoning"`
+			ReasoningDetails []struct {
+				Type      string `json:"type"`
+				Text      string `json:"text"`
+				Summary   string `json:"summary"`
+				Encrypted string `json:"encrypted"`
+			} `json:"reasoning_details"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *llmUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+		Code    any    `json:"code"`
+	} `json:"error"`
+}
+
+// answerStreamer turns completion chunks into answer.delta events. Plain
+// content is streamed until the first tool call shows up; after that only the
+// `answer` argument of a final_answer call is streamed.
+type answerStreamer struct {
+	publish func(delta string)
+	reset   func()
+
+	content   strings.Builder
+	reasoning strings.Builder
+	calls     map[int]*toolCall
+	usage     *llmUsage
+
+	emitted      int
+	contentShown bool
+}
+
+func newAnswerStreamer(publish func(string), reset func()) *answerStreamer {
+	return &answerStreamer{publish: publish, reset: reset, calls: map[int]*toolCall{}}
+}
+
+func (a *answerStreamer) consume(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			// blank separators and ": OPENROUTER PROCESSING" comments
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("completion stream: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("completion stream error: %s", chunk.Error.Message)
+		}
+		a.apply(chunk)
+	}
+	return scanner.Err()
+}
+
+func (a *answerStreamer) apply(chunk chatCompletionChunk) {
+	if chunk.Usage != nil {
+		// sent with the last chunk
+		a.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta.Reasoning != "" {
+			a.reasoning.WriteString(delta.Reasoning)
+		} else {
+			for _, item := range delta.ReasoningDetails {
+				switch {
+				case item.Summary != "":
+					a.reasoning.WriteString(item.Summary)
+				case item.Text != "":
+					a.reasoning.WriteString(item.Text)
+				}
+			}
+		}
+
+		if delta.Content != "" {
+			a.content.WriteString(delta.Content)
+			if len(a.calls) == 0 {
+				a.contentShown = true
+				a.publish(delta.Content)
+			}
+		}
+
+		for _, frag := range delta.ToolCalls {
+			call, ok := a.calls[frag.Index]
+			if !ok {
+				call = &toolCall{Type: "function"}
+				a.calls[frag.Index] = call
+			}
+			if frag.ID != "" {
+				call.ID = frag.ID
+			}
+			if frag.Type != "" {
+				call.Type = frag.Type
+			}
+			call.Function.Name += frag.Function.Name
+			call.Function.Arguments += frag.Function.Arguments
+			if call.Function.Name == "final_answer" {
+				a.streamFinalAnswer(call.Function.Arguments)
+			}
+		}
+	}
+}
+
+func (a *answerStreamer) streamFinalAnswer(args string) {
+	text, ok := partialJSONStringField(args, "answer")
+	if !ok || len(text) <= a.emitted {
+		return
+	}
+	if a.contentShown {
+		a.contentShown = false
+		a.reset()
+	}
+	a.publish(text[a.emitted:])
+	a.emitted = len(text)
+}
+
+// streamed reports whether anything was published for this completion.
+func (a *answerStreamer) streamed() bool {
+	return a.contentShown || a.emitted > 0
+}
+
+func (a *answerStreamer) response() toolStepResponse {
+	idx := make([]int, 0, len(a.calls))
+	for i := range a.calls {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	calls := make([]toolCall, 0, len(idx))
+	for _, i := range idx {
+		calls = append(calls, *a.calls[i])
+	}
+	return toolStepResponse{
+		Content:   a.content.String(),
+		ToolCalls: calls,
+		Reasoning: strings.TrimSpace(a.reasoning.String()),
+		Usage:     a.usage,
+	}
+}
+
+// partialJSONStringField decodes the value of a top-level string field from a
+// possibly truncated JSON object, returning what has been received so far.
+func partialJSONStringField(raw, key string) (string, bool) {
+	needle := `"` + key + `"`
+	idx := strings.Index(raw, needle)
+	if idx < 0 {
+		return "", false
+	}
+	rest := strings.TrimLeft(raw[idx+len(needle):], " \t\r\n")
+	if !strings.HasPrefix(rest, ":") {
+		return "", false
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\r\n")
+	if !strings.HasPrefix(rest, `"`) {
+		return "", false
+	}
+	rest = rest[1:]
+
+	var out strings.Builder
+	for i := 0; i < len(rest); {
+		c := rest[i]
+		switch {
+		case c == '"':
+			return out.String(), true
+		case c == '\\':
+			if i+1 >= len(rest) {
+				return out.String(), true
+			}
+			switch rest[i+1] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			case 'b':
+				out.WriteByte('\b')
+			case 'f':
+				out.WriteByte('\f')
+			case 'u':
+				if i+6 > len(rest) {
+					return out.String(), true
+				}
+				code, err := strconv.ParseUint(rest[i+2:i+6], 16, 32)
+				if err != nil {
+					return out.String(), true
+				}
+				r := rune(code)
+				if r >= 0xD800 && r < 0xDC00 {
+					// high surrogate: wait for the low half
+					if i+12 > len(rest) {
+						return out.String(), true
+					}
+					low, err := strconv.ParseUint(rest[i+8:i+12], 16, 32)
+					if err == nil && rest[i+6] == '\\' && rest[i+7] == 'u' {
+						r = (r-0xD800)<<10 + (rune(low) - 0xDC00) + 0x10000
+						i += 6
+					}
+				}
+				out.WriteRune(r)
+				i += 6
+				continue
+			default:
+				out.WriteByte(rest[i+1])
+			}
+			i += 2
+		default:
+			r, size := utf8.DecodeRuneInString(rest[i:])
+			if r == utf8.RuneError && size <= 1 && !utf8.FullRuneInString(rest[i:]) {
+				return out.String(), true
+			}
+			out.WriteString(rest[i : i+size])
+			i += size
+		}
+	}
+	return out.String(), true
+}
@@ -0,0 +1,36 @@
+package httpapi
+
+import "testing"
+
+func TestPartialJSONStringField(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"missing field", `{"other":"x"}`, "", false},
+		{"not a string", `{"answer": 12}`, "", false},
+		{"value not started", `{"answer":`, "", false},
+		{"complete", `{"answer":"hello","done":true}`, "hello", true},
+		{"truncated", `{"answer":"hel`, "hel", true},
+		{"spaces around colon", `{"answer" :  "hi"}`, "hi", true},
+		{"simple escapes", `{"answer":"a\nb\tc\"d\\e\/f"}`, "a\nb\tc\"d\\e/f", true},
+		{"dangling backslash", `{"answer":"ab\`, "ab", true},
+		{"unicode escape", `{"answer":"caf\u00e9"}`, "café", true},
+		{"truncated unicode escape", `{"answer":"caf\u00`, "caf", true},
+		{"surrogate pair", `{"answer":"x\ud83d\ude00y"}`, "x😀y", true},
+		{"high surrogate only", `{"answer":"x\ud83d`, "x", true},
+		{"split inside low surrogate", `{"answer":"x\ud83d\ude0`, "x", true},
+		{"raw multibyte", `{"answer":"naïve"}`, "naïve", true},
+		{"split multibyte", `{"answer":"na` + "\xc3", "na", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := partialJSONStringField(tt.raw, "answer")
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("partialJSONStringField(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ type searchResult struct {
 	Canonical  string
 	Snippet    string
 	Engine     string
+	Engines    []string
 	Raw        json.RawMessage
 	Rank       int
 	QueryIndex int
@@ -53,23 +54,6 @@ type cachedPage struct {
 	Snippets  []string
 	FetchedAt time.Time
 }
-type openRouterToolChoice struct {
-	Message struct {
-		Content          string     `json:"content"`
-		ToolCalls        []toolCall `json:"tool_calls"`
-		Reasoning        string     `json:"reasoning"`
-		ReasoningDetails []struct {
-			Type      string `json:"type"`
-			Text      string `json:"text"`
-			Summary   string `json:"summary"`
-			Encrypted string `json:"encrypted"`
-		} `json:"reasoning_details"`
-	} `json:"message"`
-}
-
-type openRouterToolResponse struct {
-	Choices []openRouterToolChoice `json:"choices"`
-}
 
 type toolCall struct {
 	ID       string `json:"id"`
@@ -80,15 +64,36 @@ type toolCall struct {
 	} `json:"function"`
 }
 
+// agentResult is the outcome of the agent loop. Model is the model that
+// produced the answer, which differs from the requested one after a fallback.
+// Degraded is set when the answer was synthesized after the loop stopped
+// without a final_answer call; DegradedReason says why it stopped. Evidence
+// holds what the fetch tool returned, indexed by citation ref.
+type agentResult struct {
+	Answer         string
+	Sources        []sourceRecord
+	Evidence       []toolSource
+	Citations      []citation
+	Model          string
+	Degraded       bool
+	DegradedReason string
+}
+
 type toolStepResponse struct {
 	Content   string
 	ToolCalls []toolCall
 	Reasoning string
+	Streamed  bool
+	Usage     *llmUsage
 }
 
 type toolSearchArgs struct {
 	Query      string `json:"query"`
 	MaxResults int    `json:"max_results"`
+	Category   string `json:"category"`
+	TimeRange  string `json:"time_range"`
+	Language   string `json:"language"`
+	Site       string `json:"site"`
 }
 
 type toolFetchArgs struct {
@@ -96,9 +101,16 @@ type toolFetchArgs struct {
 		URL   string `json:"url"`
 		Title string `json:"title"`
 	} `json:"urls"`
+	Focus string `json:"focus"`
 }
 
 func (s *Server) runPipeline(ctx context.Context, runID, query, model string) {
+	ctx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+	s.activeRuns.add(runID, cancelRun)
+	defer s.activeRuns.remove(runID)
+	go s.watchRunCancel(ctx, runID, cancelRun)
+
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.PipelineTimeout)
 	defer cancel()
 
@@ -109,12 +121,17 @@ func (s *Server) runPipeline(ctx context.Context, runID, query, model string) {
 		"items": []string{"Formulate search query", "Find sources", "Read pages", "Generate answer"},
 	})
 
-	var (
-		answer  string
-		sources []sourceRecord
-		err     error
-	)
-	answer, sources, err = s.runAgentPipeline(ctx, runID, query, model)
+	result, err := s.runAgentPipeline(ctx, runID, query, model)
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errRunCancelled):
+		s.logger.Info().Str("run_id", runID).Msg("pipeline cancelled")
+		s.publishRunCancelled(runID)
+		return
+	case errors.Is(cause, errServerShutdown):
+		// the queue worker requeues the job
+		s.logger.Info().Str("run_id", runID).Msg("pipeline interrupted by shutdown")
+		return
+	}
 	if err != nil {
 		errMsg := "agent error: " + err.Error()
 		s.logger.Error().Err(err).Str("run_id", runID).Msg("agent pipeline failed")
@@ -123,8 +140,21 @@ func (s *Server) runPipeline(ctx context.Context, runID, query, model string) {
 		return
 	}
 
-	s.publishFinal(runID, answer, model)
-	if err := s.storeAssistantMessage(ctx, runID, answer); err != nil {
+	if result.Degraded {
+		_, _ = s.pool.Exec(ctx, `update runs set degraded=true, degraded_reason=$2 where id=$1`, runID, result.DegradedReason)
+	}
+	result.Citations = s.verifyCitations(ctx, runID, result.Answer, result.Evidence)
+	s.publishFinal(runID, result)
+	// The title is best effort: it is generated while the answer is stored
+	// and waited for only briefly, so it usually lands before run.finished
+	// (clients may close the stream on it) without holding up the worker.
+	var titled <-chan struct{}
+	cancelTitle := func() {}
+	if s.cfg.ChatAutoTitle {
+		titled, cancelTitle = s.startChatTitle(ctx, runID, query, result)
+	}
+	if err := s.storeAssistantMessage(ctx, runID, result.Answer, result.Citations); err != nil {
+		cancelTitle()
 		errMsg := "store message error: " + err.Error()
 		s.logger.Error().Err(err).Str("run_id", runID).Msg("store assistant message failed")
 		s.finalizeRun(ctx, runID, errMsg)
@@ -132,35 +162,56 @@ func (s *Server) runPipeline(ctx context.Context, runID, query, model string) {
 		return
 	}
 
-	_, _ = s.pool.Exec(ctx, `update runs set status='finished', finished_at=now() where id=$1`, runID)
+	_, _ = s.pool.Exec(ctx, `update runs set status='finished', finished_at=now() where id=$1 and status='running'`, runID)
+	if titled != nil {
+		select {
+		case <-titled:
+		case <-time.After(chatTitleWait):
+		}
+	}
 	s.publishStep(ctx, runID, "run.finished", "Completed", map[string]any{"status": "ok"})
-	s.logger.Info().Str("run_id", runID).Int("sources", len(sources)).Msg("pipeline finished")
+	s.logger.Info().Str("run_id", runID).Int("sources", len(result.Sources)).Str("model", result.Model).Msg("pipeline finished")
 }
 
-func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model string) (string, []sourceRecord, error) {
+func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model string) (agentResult, error) {
+	sp, err := s.loadRunSpace(ctx, runID)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("load space failed")
+	}
 	history, err := s.loadChatHistory(ctx, runID, s.cfg.ChatHistoryLimit)
 	if err != nil {
 		s.logger.Warn().Err(err).Str("run_id", runID).Msg("load chat history failed")
 	}
 	history = trimHistory(history, query)
 	if strings.TrimSpace(model) == "" {
-		model = s.cfg.OpenRouterModels[0]
+		model = s.cfg.DefaultModel()
 	}
 
+	mc, _ := s.cfg.Model(model)
+	useTools := mc.Capabilities.Tools
+
 	nowLocal := time.Now().Format("2006-01-02 15:04:05 MST")
+	systemPrompt := "Current local date and time: " + nowLocal + "\n\n" +
+		"You are the primary research agent. Decide whether to answer directly or use tools.\n" +
+		"Use tools to search and fetch sources when needed. Keep all tool usage in this single conversation.\n" +
+		"Rules:\n" +
+		"- Cite sources as [n], where n is the ref the fetch tool returned for the source.\n" +
+		"- If you need more info, call the search tool with a focused query.\n" +
+		"- If you have URLs to read, call the fetch tool.\n" +
+		"- When enough evidence is collected, call final_answer with the full answer in Markdown.\n" +
+		"- Do not answer directly in plain content.\n\n" +
+		"Math: use $...$ for inline and $$...$$ for display math."
+	if !useTools {
+		// models served without tool calling answer from their own knowledge
+		systemPrompt = "Current local date and time: " + nowLocal + "\n\n" +
+			"You are a helpful assistant. Answer the question in Markdown. Web search is not available for this model.\n\n" +
+			"Math: use $...$ for inline and $$...$$ for display math."
+	}
+	systemPrompt += sp.promptInstructions()
 	messages := make([]map[string]any, 0, len(history)+2)
 	messages = append(messages, map[string]any{
-		"role": "system",
-		"content": "Current local date and time: " + nowLocal + "\n\n" +
-			"You are the primary research agent. Decide whether to answer directly or use tools.\n" +
-			"Use tools to search and fetch sources when needed. Keep all tool usage in this single conversation.\n" +
-			"Rules:\n" +
-			"- Cite sources as [n].\n" +
-			"- If you need more info, call the search tool with a focused query.\n" +
-			"- If you have URLs to read, call the fetch tool.\n" +
-			"- When enough evidence is collected, call final_answer with the full answer in Markdown.\n" +
-			"- Do not answer directly in plain content.\n\n" +
-			"Math: use $...$ for inline and $$...$$ for display math.",
+		"role":    "system",
+		"content": systemPrompt,
 	})
 	for _, msg := range history {
 		role := strings.TrimSpace(msg.Role)
@@ -177,6 +228,7 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 		})
 	}
 	messages = append(messages, map[string]any{"role": "user", "content": query})
+	window := &contextWindow{messages: messages, queryIdx: len(messages) - 1}
 
 	tools := []map[string]any{
 		{
@@ -189,6 +241,24 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 					"properties": map[string]any{
 						"query":       map[string]any{"type": "string"},
 						"max_results": map[string]any{"type": "integer"},
+						"category": map[string]any{
+							"type":        "string",
+							"enum":        searchCategories,
+							"description": "Vertical to search; defaults to general.",
+						},
+						"time_range": map[string]any{
+							"type":        "string",
+							"enum":        searchTimeRanges,
+							"description": "Only return results published within this period.",
+						},
+						"language": map[string]any{
+							"type":        "string",
+							"description": "Result language as an ISO 639-1 code, e.g. en or ru.",
+						},
+						"site": map[string]any{
+							"type":        "string",
+							"description": "Restrict results to this domain, e.g. go.dev.",
+						},
 					},
 					"required": []string{"query"},
 				},
@@ -198,7 +268,7 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 			"type": "function",
 			"function": map[string]any{
 				"name":        "fetch",
-				"description": "Fetch and extract snippets from a list of URLs.",
+				"description": "Fetch pages and return the passages most relevant to the question, with citation refs.",
 				"parameters": map[string]any{
 					"type": "object",
 					"properties": map[string]any{
@@ -213,6 +283,10 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 								"required": []string{"url"},
 							},
 						},
+						"focus": map[string]any{
+							"type":        "string",
+							"description": "What to look for on the pages; defaults to the user question.",
+						},
 					},
 					"required": []string{"urls"},
 				},
@@ -234,8 +308,10 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 		},
 	}
 
+	chain := s.newModelChain(model)
 	seenURLs := map[string]struct{}{}
 	collectedSources := make([]sourceRecord, 0, s.cfg.SearchMaxSources)
+	evidence := make([]toolSource, 0, s.cfg.SearchMaxSources)
 	searchCalls := 0
 
 	maxIterations := s.cfg.SearchMaxQueries + 4
@@ -244,9 +320,21 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 	}
 
 	for i := 0; i < maxIterations; i++ {
-		resp, err := s.openRouterToolStep(ctx, model, messages, tools)
+		if i > 0 && useTools {
+			if over, spent := s.runBudgetExceeded(ctx, runID); over {
+				s.publishStep(ctx, runID, "budget.exceeded", "Budget reached", map[string]any{
+					"total_tokens": spent.TotalTokens,
+					"cost":         roundCost(spent.Cost),
+					"max_tokens":   s.cfg.RunMaxTokens,
+					"max_cost":     s.cfg.RunMaxCost,
+				})
+				return s.degradedResult(ctx, runID, query, chain, window, tools, collectedSources, evidence, degradedBudget)
+			}
+		}
+
+		resp, err := s.chatWithFallback(ctx, runID, chain, window, tools, nil)
 		if err != nil {
-			return "", collectedSources, err
+			return agentResult{Sources: collectedSources, Model: chain.current}, err
 		}
 
 		if strings.TrimSpace(resp.Reasoning) != "" {
@@ -255,12 +343,18 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 			})
 		}
 
+		if !useTools && strings.TrimSpace(resp.Content) != "" {
+			return agentResult{Answer: strings.TrimSpace(resp.Content), Sources: collectedSources, Model: chain.current}, nil
+		}
 		if len(resp.ToolCalls) == 0 {
 			if strings.TrimSpace(resp.Content) != "" {
 				s.publishStep(ctx, runID, "agent.message", "Agent message", map[string]any{
 					"content": resp.Content,
 				})
 			}
+			if resp.Streamed {
+				s.publishAnswerReset(runID)
+			}
 			continue
 		}
 
@@ -270,7 +364,7 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 			})
 		}
 
-		messages = append(messages, map[string]any{
+		window.messages = append(window.messages, map[string]any{
 			"role":       "assistant",
 			"content":    resp.Content,
 			"tool_calls": resp.ToolCalls,
@@ -298,8 +392,16 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 					callErr = fmt.Errorf("query is required")
 					break
 				}
+				if strings.TrimSpace(parsed.Category) == "" && sp != nil {
+					parsed.Category = sp.SearchCategory
+				}
+				req, err := newSearchRequest(parsed, searchCalls+1)
+				if err != nil {
+					callErr = err
+					break
+				}
 				searchCalls++
-				results, err := s.searchProvider(ctx, runID, parsed.Query, searchCalls, s.cfg.SearchMaxQueries)
+				results, err := s.runSearch(ctx, runID, sp, req, s.cfg.SearchMaxQueries)
 				if err != nil {
 					callErr = err
 					break
@@ -316,11 +418,16 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 					break
 				}
 				items := make([]searchResult, 0, len(parsed.URLs))
+				blocked := []string{}
 				for _, item := range parsed.URLs {
 					urlStr := strings.TrimSpace(item.URL)
 					if urlStr == "" {
 						continue
 					}
+					if !sp.allowsURL(urlStr) {
+						blocked = append(blocked, urlStr)
+						continue
+					}
 					key := canonicalizeURL(urlStr)
 					if key == "" {
 						key = urlStr
@@ -340,6 +447,9 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 				}
 				if len(items) == 0 {
 					result = map[string]any{"items": []any{}}
+					if len(blocked) > 0 {
+						result = map[string]any{"items": []any{}, "blocked": blocked, "error": "these domains are excluded in this space"}
+					}
 					break
 				}
 				s.publishStep(ctx, runID, "agent.fetch", "Reading sources", map[string]any{
@@ -353,14 +463,22 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 					callErr = err
 					break
 				}
-				if err := s.readSources(ctx, runID, sources); err != nil {
+				if err := s.readSources(withFetchSpace(ctx, sp), runID, sources); err != nil {
 					callErr = err
 					break
 				}
-				collectedSources = append(collectedSources, sources...)
-				result = map[string]any{
-					"sources": sources,
+				focus := strings.TrimSpace(parsed.Focus)
+				if focus == "" {
+					focus = query
+				}
+				extracted := s.extractSnippets(ctx, runID, focus, sources, len(collectedSources)+1)
+				if len(blocked) > 0 {
+					result = map[string]any{"sources": extracted, "blocked": blocked}
+				} else {
+					result = map[string]any{"sources": extracted}
 				}
+				collectedSources = append(collectedSources, sources...)
+				evidence = append(evidence, extracted...)
 
 			case "final_answer":
 				var payload struct {
@@ -375,7 +493,7 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 					callErr = fmt.Errorf("answer is empty")
 					break
 				}
-				return answer, collectedSources, nil
+				return agentResult{Answer: answer, Sources: collectedSources, Evidence: evidence, Model: chain.current}, nil
 
 			default:
 				callErr = fmt.Errorf("unknown tool: %s", name)
@@ -388,225 +506,32 @@ func (s *Server) runAgentPipeline(ctx context.Context, runID, query, model strin
 				toolPayload["result"] = result
 			}
 			toolJSON, _ := json.Marshal(toolPayload)
-			messages = append(messages, map[string]any{
+			window.messages = append(window.messages, map[string]any{
 				"role":         "tool",
 				"tool_call_id": call.ID,
 				"name":         name,
 				"content":      string(toolJSON),
 			})
 		}
-	}
-
-	return fallbackAnswerSimple(query), collectedSources, nil
-}
-
-func (s *Server) searchProvider(ctx context.Context, runID, query string, queryIndex, totalQueries int) ([]searchResult, error) {
-	switch strings.ToLower(strings.TrimSpace(s.cfg.SearchProvider)) {
-	case "", "searxng", "searx":
-		return s.searchSearx(ctx, runID, query, queryIndex, totalQueries)
-	case "serper":
-		return s.searchSerper(ctx, runID, query, queryIndex, totalQueries)
-	default:
-		return nil, fmt.Errorf("unknown SEARCH_PROVIDER: %s", s.cfg.SearchProvider)
-	}
-}
-
-func (s *Server) searchSearx(ctx context.Context, runID, query string, queryIndex, totalQueries int) ([]searchResult, error) {
-	s.publishStep(ctx, runID, "search.query", "Search", map[string]any{
-		"query":       query,
-		"category":    "general",
-		"query_index": queryIndex,
-		"total":       totalQueries,
-	})
-
-	var queryID string
-	if err := s.pool.QueryRow(ctx, `insert into search_queries(run_id, query, category) values ($1,$2,'general') returning id`, runID, query).Scan(&queryID); err != nil {
-		return nil, err
-	}
-
-	endpoint := strings.TrimRight(s.cfg.SearxNGBaseURL, "/") + "/search"
-	reqURL, err := url.Parse(endpoint)
-	if err != nil {
-		return nil, err
-	}
-	q := reqURL.Query()
-	q.Set("format", "json")
-	q.Set("q", query)
-	reqURL.RawQuery = q.Encode()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", "gosearch-ai/0.1")
-
-	client := &http.Client{Timeout: s.cfg.SearchTimeout}
-	resp, err := client.Do(req)
-	if err != nil {
-		s.logger.Error().Err(err).Str("run_id", runID).Msg("searxng request failed")
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		s.logger.Error().Int("status", resp.StatusCode).Str("run_id", runID).Msg("searxng non-200")
-		return nil, fmt.Errorf("searxng status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
-	}
-
-	var payload struct {
-		Results []map[string]any `json:"results"`
-	}
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&payload); err != nil {
-		s.logger.Error().Err(err).Str("run_id", runID).Msg("searxng decode failed")
-		return nil, err
-	}
-
-	results := make([]searchResult, 0, len(payload.Results))
-	rank := 1
-	for _, item := range payload.Results {
-		title, _ := item["title"].(string)
-		rawURL, _ := item["url"].(string)
-		content, _ := item["content"].(string)
-		engine, _ := item["engine"].(string)
-		if rawURL == "" {
-			continue
+		if resp.Streamed {
+			// the streamed text did not become the final answer
+			s.publishAnswerReset(runID)
 		}
-		canonical := canonicalizeURL(rawURL)
-		rawJSON, _ := json.Marshal(item)
-		results = append(results, searchResult{
-			Title:      title,
-			URL:        rawURL,
-			Canonical:  canonical,
-			Snippet:    content,
-			Engine:     engine,
-			Raw:        rawJSON,
-			Rank:       rank,
-			QueryIndex: queryIndex,
-			Score:      scoreResult(rank, queryIndex, rawURL, title, content),
-		})
-		rank++
-	}
-
-	if err := s.storeSearchResults(ctx, queryID, results); err != nil {
-		s.logger.Error().Err(err).Str("run_id", runID).Msg("store search results failed")
-		return nil, err
 	}
 
-	s.publishStep(ctx, runID, "search.results", "Search results", map[string]any{
-		"count":       len(results),
-		"query":       query,
-		"query_index": queryIndex,
-		"total":       totalQueries,
-		"results":     normalizeResults(results),
-	})
-
-	return results, nil
+	return s.degradedResult(ctx, runID, query, chain, window, tools, collectedSources, evidence, degradedMaxIterations)
 }
 
-func (s *Server) searchSerper(ctx context.Context, runID, query string, queryIndex, totalQueries int) ([]searchResult, error) {
-	if strings.TrimSpace(s.cfg.SerperAPIKey) == "" {
-		return nil, fmt.Errorf("SERPER_API_KEY is required for serper provider")
-	}
-
-	s.publishStep(ctx, runID, "search.query", "Search", map[string]any{
-		"query":       query,
-		"category":    "general",
-		"query_index": queryIndex,
-		"total":       totalQueries,
-		"provider":    "serper",
-	})
-
-	var queryID string
-	if err := s.pool.QueryRow(ctx, `insert into search_queries(run_id, query, category) values ($1,$2,'general') returning id`, runID, query).Scan(&queryID); err != nil {
-		return nil, err
-	}
-
-	payload := map[string]any{
-		"q":   query,
-		"num": s.cfg.SerperNum,
-		"hl":  s.cfg.SerperHL,
-		"gl":  s.cfg.SerperGL,
-	}
-	body, _ := json.Marshal(payload)
-
-	endpoint := strings.TrimRight(s.cfg.SerperBaseURL, "/") + "/search"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.cfg.SerperAPIKey)
-	req.Header.Set("User-Agent", "gosearch-ai/0.1")
-
-	client := &http.Client{Timeout: s.cfg.SearchTimeout}
-	resp, err := client.Do(req)
-	if err != nil {
-		s.logger.Error().Err(err).Str("run_id", runID).Msg("serper request failed")
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		s.logger.Error().Int("status", resp.StatusCode).Str("run_id", runID).Msg("serper non-200")
-		return nil, fmt.Errorf("serper status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
-	}
-
-	var payloadResp struct {
-		Organic []struct {
-			Title    string `json:"title"`
-			Link     string `json:"link"`
-			Snippet  string `json:"snippet"`
-			Position int    `json:"position"`
-		} `json:"organic"`
-	}
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&payloadResp); err != nil {
-		s.logger.Error().Err(err).Str("run_id", runID).Msg("serper decode failed")
-		return nil, err
-	}
-
-	results := make([]searchResult, 0, len(payloadResp.Organic))
-	for i, item := range payloadResp.Organic {
-		rawURL := strings.TrimSpace(item.Link)
-		if rawURL == "" {
-			continue
-		}
-		rank := item.Position
-		if rank <= 0 {
-			rank = i + 1
-		}
-		canonical := canonicalizeURL(rawURL)
-		rawJSON, _ := json.Marshal(item)
-		results = append(results, searchResult{
-			Title:      item.Title,
-			URL:        rawURL,
-			Canonical:  canonical,
-			Snippet:    item.Snippet,
-			Engine:     "serper",
-			Raw:        rawJSON,
-			Rank:       rank,
-			QueryIndex: queryIndex,
-			Score:      scoreResult(rank, queryIndex, rawURL, item.Title, item.Snippet),
-		})
-	}
-
-	if err := s.storeSearchResults(ctx, queryID, results); err != nil {
-		s.logger.Error().Err(err).Str("run_id", runID).Msg("store search results failed")
-		return nil, err
-	}
-
-	s.publishStep(ctx, runID, "search.results", "Search results", map[string]any{
-		"count":       len(results),
-		"query":       query,
-		"query_index": queryIndex,
-		"total":       totalQueries,
-		"results":     normalizeResults(results),
-	})
-
-	return results, nil
+func (s *Server) degradedResult(ctx context.Context, runID, query string, chain *modelChain, w *contextWindow, tools []map[string]any, sources []sourceRecord, evidence []toolSource, reason string) (agentResult, error) {
+	answer, err := s.synthesizeAnswer(ctx, runID, query, chain, w, tools, evidence, reason)
+	return agentResult{
+		Answer:         answer,
+		Sources:        sources,
+		Evidence:       evidence,
+		Model:          chain.current,
+		Degraded:       true,
+		DegradedReason: reason,
+	}, err
 }
 
 func (s *Server) storeSearchResults(ctx context.Context, queryID string, results []searchResult) error {
@@ -672,137 +597,159 @@ func (s *Server) persistSources(ctx context.Context, runID string, selected []se
 	return records, nil
 }
 
-func (s *Server) readSources(ctx context.Context, runID string, sources []sourceRecord) error {
-	client := &http.Client{Timeout: s.cfg.FetchTimeout}
+// readSource fetches one source and fills in its title and content. Steps are
+// recorded into steps instead of being published; readSources flushes them.
+func (s *Server) readSource(ctx context.Context, runID string, source *sourceRecord, steps *stepBuffer) {
+	client := s.fetchClient
 	cacheTTL := s.cfg.PageCacheTTL
 
-	for i := range sources {
-		source := &sources[i]
-		s.publishStep(ctx, runID, "page.fetch.started", "Requesting page", map[string]any{"url": source.URL})
-
-		cached, ok, err := s.loadCachedPage(ctx, source.URL)
-		if err == nil && ok && cached.Content != "" && time.Since(cached.FetchedAt) < cacheTTL {
-			s.logger.Debug().Str("run_id", runID).Str("url", source.URL).Msg("page cache hit")
-			cached.Title = sanitizeUTF8(cached.Title)
-			cached.Content = sanitizeUTF8(cached.Content)
-			if cached.Title != "" && source.Title == "" {
-				source.Title = cached.Title
-				_, _ = s.pool.Exec(ctx, `update sources set title=$1 where id=$2`, cached.Title, source.ID)
-			}
+	steps.add("page.fetch.started", "Requesting page", map[string]any{"url": source.URL})
 
-			s.publishStep(ctx, runID, "page.fetch.ok", "Page cache", map[string]any{
-				"url":         source.URL,
-				"cached":      true,
-				"age_seconds": int(time.Since(cached.FetchedAt).Seconds()),
-			})
-
-			s.publishStep(ctx, runID, "page.readability.ready", "Page read", map[string]any{
-				"url":    source.URL,
-				"title":  cached.Title,
-				"length": len(cached.Content),
-			})
-
-			// Convert cached content to Markdown
-			source.MarkdownContent = s.convertToMarkdown(cached.Content, source.URL)
-			continue
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
-		if err != nil {
-			s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("build page request failed")
-			s.publishStep(ctx, runID, "page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": err.Error()})
-			continue
-		}
-		req.Header.Set("User-Agent", "gosearch-ai/0.1")
+	parsedURL, err := url.Parse(source.URL)
+	if err == nil {
+		err = s.fetchPolicy.checkURL(ctx, parsedURL)
+	}
+	if err != nil {
+		s.recordFetchFailure(steps, runID, source.URL, err)
+		return
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("page fetch failed")
-			s.publishStep(ctx, runID, "page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": err.Error()})
-			continue
-		}
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			_ = resp.Body.Close()
-			errMsg := fmt.Errorf("status %d", resp.StatusCode)
-			s.logger.Warn().Err(errMsg).Str("run_id", runID).Str("url", source.URL).Msg("page fetch non-200")
-			s.publishStep(ctx, runID, "page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": errMsg.Error()})
-			continue
+	cached, ok, err := s.loadCachedPage(ctx, source.URL)
+	if err == nil && ok && cached.Content != "" && time.Since(cached.FetchedAt) < cacheTTL {
+		s.logger.Debug().Str("run_id", runID).Str("url", source.URL).Msg("page cache hit")
+		cached.Title = sanitizeUTF8(cached.Title)
+		cached.Content = sanitizeUTF8(cached.Content)
+		if cached.Title != "" && source.Title == "" {
+			source.Title = cached.Title
+			_, _ = s.pool.Exec(ctx, `update sources set title=$1 where id=$2`, cached.Title, source.ID)
 		}
 
-		contentType := resp.Header.Get("Content-Type")
-		if isPDFContentType(contentType, source.URL) {
-			s.publishStep(ctx, runID, "page.fetch.pdf", "PDF received", map[string]any{"url": source.URL, "cached": false})
-			text, err := extractPDFText(resp.Body, resp.ContentLength)
-			_ = resp.Body.Close()
-			if err != nil {
-				s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("pdf extract failed")
-				s.publishStep(ctx, runID, "page.fetch.error", "PDF error", map[string]any{"url": source.URL, "error": err.Error()})
-				continue
-			}
-
-			s.publishStep(ctx, runID, "page.fetch.ok", "PDF extracted", map[string]any{"url": source.URL, "bytes": len(text), "cached": false})
+		steps.add("page.fetch.ok", "Page cache", map[string]any{
+			"url":         source.URL,
+			"cached":      true,
+			"age_seconds": int(time.Since(cached.FetchedAt).Seconds()),
+		})
 
-			text = sanitizeUTF8(text)
-			s.publishStep(ctx, runID, "page.readability.ready", "PDF read", map[string]any{
-				"url":    source.URL,
-				"title":  source.Title,
-				"length": len(text),
-			})
+		steps.add("page.readability.ready", "Page read", map[string]any{
+			"url":    source.URL,
+			"title":  cached.Title,
+			"length": len(cached.Content),
+		})
 
-			if err := s.upsertPageCache(ctx, source.URL, source.Title, text); err != nil {
-				s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("cache upsert failed")
-			}
+		// Convert cached content to Markdown
+		source.MarkdownContent = s.convertToMarkdown(cached.Content, source.URL)
+		return
+	}
 
-			// PDF text is already plain text, use as-is
-			source.MarkdownContent = text
-			continue
-		}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("build page request failed")
+		steps.add("page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": err.Error()})
+		return
+	}
+	req.Header.Set("User-Agent", "gosearch-ai/0.1")
 
-		if !isTextContentType(contentType, source.URL) {
-			_ = resp.Body.Close()
-			s.logger.Warn().Str("run_id", runID).Str("url", source.URL).Str("content_type", contentType).Msg("page fetch skipped")
-			s.publishStep(ctx, runID, "page.fetch.skipped", "Skipped unsupported type", map[string]any{
-				"url":          source.URL,
-				"content_type": contentType,
-			})
-			continue
-		}
+	resp, err := client.Do(req)
+	if err != nil {
+		s.recordFetchFailure(steps, runID, source.URL, err)
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		_ = resp.Body.Close()
+		errMsg := fmt.Errorf("status %d", resp.StatusCode)
+		s.logger.Warn().Err(errMsg).Str("run_id", runID).Str("url", source.URL).Msg("page fetch non-200")
+		steps.add("page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": errMsg.Error()})
+		return
+	}
 
-		body, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	contentType := resp.Header.Get("Content-Type")
+	if isPDFContentType(contentType, source.URL) {
+		steps.add("page.fetch.pdf", "PDF received", map[string]any{"url": source.URL, "cached": false})
+		text, err := extractPDFText(resp.Body, resp.ContentLength)
 		_ = resp.Body.Close()
 		if err != nil {
-			errMsg := err
-			s.logger.Warn().Err(errMsg).Str("run_id", runID).Str("url", source.URL).Msg("page read failed")
-			s.publishStep(ctx, runID, "page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": errMsg.Error()})
-			continue
+			s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("pdf extract failed")
+			steps.add("page.fetch.error", "PDF error", map[string]any{"url": source.URL, "error": err.Error()})
+			return
 		}
 
-		s.publishStep(ctx, runID, "page.fetch.ok", "Page received", map[string]any{"url": source.URL, "bytes": len(body), "cached": false})
+		steps.add("page.fetch.ok", "PDF extracted", map[string]any{"url": source.URL, "bytes": len(text), "cached": false})
 
-		title, text := extractText(body)
-		title = sanitizeUTF8(title)
 		text = sanitizeUTF8(text)
-		if title != "" && source.Title == "" {
-			source.Title = title
-			_, _ = s.pool.Exec(ctx, `update sources set title=$1 where id=$2`, title, source.ID)
-		}
-
-		s.publishStep(ctx, runID, "page.readability.ready", "Page read", map[string]any{
+		steps.add("page.readability.ready", "PDF read", map[string]any{
 			"url":    source.URL,
-			"title":  title,
+			"title":  source.Title,
 			"length": len(text),
 		})
 
-		if err := s.upsertPageCache(ctx, source.URL, title, text); err != nil {
+		if err := s.upsertPageCache(ctx, source.URL, source.Title, text); err != nil {
 			s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("cache upsert failed")
 		}
 
-		// Convert HTML to Markdown
-		markdownContent := s.convertToMarkdown(string(body), source.URL)
-		source.MarkdownContent = markdownContent
+		// PDF text is already plain text, use as-is
+		source.MarkdownContent = text
+		return
 	}
 
-	return nil
+	if !isTextContentType(contentType, source.URL) {
+		_ = resp.Body.Close()
+		s.logger.Warn().Str("run_id", runID).Str("url", source.URL).Str("content_type", contentType).Msg("page fetch skipped")
+		steps.add("page.fetch.skipped", "Skipped unsupported type", map[string]any{
+			"url":          source.URL,
+			"content_type": contentType,
+		})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	_ = resp.Body.Close()
+	if err != nil {
+		errMsg := err
+		s.logger.Warn().Err(errMsg).Str("run_id", runID).Str("url", source.URL).Msg("page read failed")
+		steps.add("page.fetch.error", "Request error", map[string]any{"url": source.URL, "error": errMsg.Error()})
+		return
+	}
+
+	steps.add("page.fetch.ok", "Page received", map[string]any{"url": source.URL, "bytes": len(body), "cached": false})
+
+	title, text := extractText(body)
+	title = sanitizeUTF8(title)
+	text = sanitizeUTF8(text)
+	if title != "" && source.Title == "" {
+		source.Title = title
+		_, _ = s.pool.Exec(ctx, `update sources set title=$1 where id=$2`, title, source.ID)
+	}
+
+	steps.add("page.readability.ready", "Page read", map[string]any{
+		"url":    source.URL,
+		"title":  title,
+		"length": len(text),
+	})
+
+	if err := s.upsertPageCache(ctx, source.URL, title, text); err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("cache upsert failed")
+	}
+
+	// Convert HTML to Markdown
+	markdownContent := s.convertToMarkdown(string(body), source.URL)
+	source.MarkdownContent = markdownContent
+}
+
+// recordFetchFailure records a failed fetch, using page.fetch.blocked when
+// the fetch policy refused the URL or a redirect hop.
+func (s *Server) recordFetchFailure(steps *stepBuffer, runID, pageURL string, err error) {
+	var blocked *fetchBlockedError
+	if errors.As(err, &blocked) {
+		s.logger.Warn().Str("run_id", runID).Str("url", pageURL).Str("reason", blocked.Reason).Msg("page fetch blocked")
+		steps.add("page.fetch.blocked", "Blocked", map[string]any{
+			"url":    pageURL,
+			"target": blocked.URL,
+			"reason": blocked.Reason,
+		})
+		return
+	}
+	s.logger.Warn().Err(err).Str("run_id", runID).Str("url", pageURL).Msg("page fetch failed")
+	steps.add("page.fetch.error", "Request error", map[string]any{"url": pageURL, "error": err.Error()})
 }
 
 // convertToMarkdown converts HTML content to Markdown using html-to-markdown library
@@ -856,141 +803,45 @@ func (s *Server) upsertPageCache(ctx context.Context, pageURL, title, content st
 	return err
 }
 
-func (s *Server) openRouterToolStep(ctx context.Context, model string, messages []map[string]any, tools []map[string]any) (toolStepResponse, error) {
-	if strings.TrimSpace(model) == "" {
-		model = s.cfg.OpenRouterModels[0]
-	}
-
-	reqBody := map[string]any{
-		"model":    model,
-		"stream":   false,
-		"messages": messages,
-		"tools":    tools,
-	}
-	if s.cfg.OpenRouterReasoning {
-		reqBody["reasoning"] = map[string]any{
-			"effort":  s.cfg.OpenRouterReasoningEffort,
-			"exclude": false,
-		}
-	}
-	payload, _ := json.Marshal(reqBody)
-	var payloadResp openRouterToolResponse
-	for attempt := 0; attempt <= s.cfg.OpenRouterRetries; attempt++ {
-		body, err := s.openRouterRequest(ctx, payload)
-		if err != nil {
-			return toolStepResponse{}, err
-		}
-		if err := json.Unmarshal(body, &payloadResp); err != nil {
-			if isJSONTruncated(err) && attempt < s.cfg.OpenRouterRetries {
-				continue
-			}
-			return toolStepResponse{}, err
-		}
-		break
-	}
-	if len(payloadResp.Choices) == 0 {
-		return toolStepResponse{}, fmt.Errorf("openrouter: empty response")
-	}
-	msg := payloadResp.Choices[0].Message
-	reasoning := strings.TrimSpace(msg.Reasoning)
-	if reasoning == "" && len(msg.ReasoningDetails) > 0 {
-		var parts []string
-		for _, item := range msg.ReasoningDetails {
-			switch {
-			case item.Summary != "":
-				parts = append(parts, item.Summary)
-			case item.Text != "":
-				parts = append(parts, item.Text)
-			case item.Encrypted != "":
-				parts = append(parts, item.Encrypted)
-			}
-		}
-		reasoning = strings.Join(parts, "\n")
+func (s *Server) storeAssistantMessage(ctx context.Context, runID, answer string, citations []citation) error {
+	if citations == nil {
+		citations = []citation{}
 	}
-	return toolStepResponse{Content: msg.Content, ToolCalls: msg.ToolCalls, Reasoning: reasoning}, nil
-}
-
-func (s *Server) openRouterRequest(ctx context.Context, payload []byte) ([]byte, error) {
-	reqURL := strings.TrimRight(s.cfg.OpenRouterBaseURL, "/") + "/chat/completions"
-	var lastErr error
-	for attempt := 0; attempt <= s.cfg.OpenRouterRetries; attempt++ {
-		if attempt > 0 {
-			if ctx.Err() != nil {
-				return nil, ctx.Err()
-			}
-			time.Sleep(s.cfg.OpenRouterRetryDelay)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(payload))
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Authorization", "Bearer "+s.cfg.OpenRouterAPIKey)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("HTTP-Referer", s.cfg.BaseURL)
-		req.Header.Set("X-Title", "gosearch-ai")
-
-		client := &http.Client{Timeout: s.cfg.OpenRouterTimeout}
-		resp, err := client.Do(req)
-		if err != nil {
-			lastErr = err
-			if shouldRetryOpenRouter(err, 0) && attempt < s.cfg.OpenRouterRetries {
-				continue
-			}
-			return nil, err
-		}
-
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
-		_ = resp.Body.Close()
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			lastErr = fmt.Errorf("openrouter status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
-			if shouldRetryOpenRouter(nil, resp.StatusCode) && attempt < s.cfg.OpenRouterRetries {
-				continue
-			}
-			return nil, lastErr
-		}
-		return body, nil
+	citationsJSON, err := json.Marshal(citations)
+	if err != nil {
+		return err
 	}
-	return nil, lastErr
-}
 
-func shouldRetryOpenRouter(err error, status int) bool {
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return true
-		}
-		if strings.Contains(strings.ToLower(err.Error()), "context deadline exceeded") {
-			return true
-		}
-		if strings.Contains(strings.ToLower(err.Error()), "timeout") {
-			return true
-		}
-		return false
-	}
-	if status == http.StatusTooManyRequests || status == http.StatusRequestTimeout {
-		return true
-	}
-	if status >= 500 && status <= 599 {
-		return true
+		return err
 	}
-	return false
-}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-func isJSONTruncated(err error) bool {
-	if err == nil {
-		return false
+	var chatID, messageID string
+	var parentID *string
+	if err := tx.QueryRow(
+		ctx,
+		`insert into messages(chat_id, user_id, role, content, run_id, citations, parent_message_id)
+		 select chat_id, user_id, 'assistant', $2, id, $3, user_message_id from runs where id=$1
+		 returning chat_id, id, parent_message_id`,
+		runID,
+		answer,
+		citationsJSON,
+	).Scan(&chatID, &messageID, &parentID); err != nil {
+		return err
 	}
-	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "unexpected end of json input")
-}
-
-func (s *Server) storeAssistantMessage(ctx context.Context, runID, answer string) error {
-	var chatID string
-	if err := s.pool.QueryRow(ctx, `select chat_id from runs where id=$1`, runID).Scan(&chatID); err != nil {
+	// follow the new answer unless the user switched branches meanwhile
+	if _, err := tx.Exec(
+		ctx,
+		`update chats set active_message_id=$2 where id=$1 and active_message_id is not distinct from $3`,
+		chatID,
+		messageID,
+		parentID,
+	); err != nil {
 		return err
 	}
-	_, err := s.pool.Exec(ctx, `insert into messages(chat_id, user_id, role, content, run_id) select $1, user_id, 'assistant', $2, $3 from runs where id=$3`, chatID, answer, runID)
-	return err
+	return tx.Commit(ctx)
 }
 
 func (s *Server) loadChatHistory(ctx context.Context, runID string, limit int) ([]chatMessage, error) {
@@ -999,15 +850,18 @@ func (s *Server) loadChatHistory(ctx context.Context, runID string, limit int) (
 	}
 	rows, err := s.pool.Query(
 		ctx,
-		`select role, content from (
-			select m.role, m.content, m.created_at
+		`with recursive branch as (
+			select m.id, m.parent_message_id, m.role, m.content, 1 as depth
 			from messages m
-			join runs r on r.chat_id = m.chat_id
+			join runs r on r.user_message_id = m.id
 			where r.id=$1
-			order by m.created_at desc
-			limit $2
-		) t
-		order by created_at asc`,
+			union all
+			select m.id, m.parent_message_id, m.role, m.content, b.depth + 1
+			from messages m
+			join branch b on m.id = b.parent_message_id
+			where b.depth < $2
+		)
+		select role, content from branch order by depth desc`,
 		runID,
 		limit,
 	)
@@ -1039,7 +893,8 @@ func trimHistory(history []chatMessage, query string) []chatMessage {
 }
 
 func (s *Server) finalizeRun(ctx context.Context, runID, errMsg string) {
-	_, _ = s.pool.Exec(ctx, `update runs set status='failed', finished_at=now(), error=$2 where id=$1`, runID, errMsg)
+	// a timed-out ctx must not prevent recording the failure
+	_, _ = s.pool.Exec(context.WithoutCancel(ctx), `update runs set status='failed', finished_at=now(), error=$2 where id=$1 and status='running'`, runID, errMsg)
 }
 
 func urlsFromResults(results []searchResult) []string {
@@ -1053,13 +908,17 @@ func urlsFromResults(results []searchResult) []string {
 func normalizeResults(results []searchResult) []map[string]any {
 	out := make([]map[string]any, 0, len(results))
 	for _, res := range results {
-		out = append(out, map[string]any{
+		item := map[string]any{
 			"title":   res.Title,
 			"url":     res.URL,
 			"snippet": res.Snippet,
 			"engine":  res.Engine,
 			"score":   res.Score,
-		})
+		}
+		if len(res.Engines) > 0 {
+			item["engines"] = res.Engines
+		}
+		out = append(out, item)
 	}
 	return out
 }
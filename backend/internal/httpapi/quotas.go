@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// concurrentRunRetry is suggested to clients refused for having too many
+// runs in flight; there is no way to know when one of them will finish.
+const concurrentRunRetry = 15 * time.Second
+
+// quotaError is a refused run start.
+type quotaError struct {
+	Quota      string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *quotaError) Error() string { return e.Message }
+
+// checkRunQuota enforces the per-user limits before a run is queued. It runs
+// in the transaction that inserts the run, after lockUserRuns, so parallel
+// starts of one user see each other. Limits set to zero are not checked.
+func (s *Server) checkRunQuota(ctx context.Context, tx pgx.Tx, userID string) (*quotaError, error) {
+	now := time.Now()
+
+	if limit := s.cfg.QuotaConcurrentRuns; limit > 0 {
+		var active int
+		if err := tx.QueryRow(ctx, `select count(*) from runs where user_id=$1 and status in ('queued','running')`, userID).Scan(&active); err != nil {
+			return nil, err
+		}
+		if active >= limit {
+			return &quotaError{
+				Quota:      "concurrent_runs",
+				Message:    fmt.Sprintf("too many active runs (limit %d)", limit),
+				RetryAfter: concurrentRunRetry,
+			}, nil
+		}
+	}
+
+	if limit := s.cfg.QuotaRunsPerHour; limit > 0 {
+		var count int
+		var oldest *time.Time
+		if err := tx.QueryRow(
+			ctx,
+			`select count(*), min(started_at) from run_starts where user_id=$1 and started_at > now() - interval '1 hour'`,
+			userID,
+		).Scan(&count, &oldest); err != nil {
+			return nil, err
+		}
+		if count >= limit && oldest != nil {
+			return &quotaError{
+				Quota:      "runs_per_hour",
+				Message:    fmt.Sprintf("hourly run limit reached (limit %d)", limit),
+				RetryAfter: oldest.Add(time.Hour).Sub(now),
+			}, nil
+		}
+	}
+
+	if s.cfg.QuotaDailyTokens > 0 || s.cfg.QuotaDailyCost > 0 {
+		dayStart := now.UTC().Truncate(24 * time.Hour)
+		var tokens int64
+		var cost float64
+		if err := tx.QueryRow(
+			ctx,
+			`select coalesce(sum(total_tokens), 0), coalesce(sum(cost), 0) from llm_calls where user_id=$1 and created_at >= $2`,
+			userID,
+			dayStart,
+		).Scan(&tokens, &cost); err != nil {
+			return nil, err
+		}
+		untilTomorrow := dayStart.Add(24 * time.Hour).Sub(now)
+		if limit := s.cfg.QuotaDailyTokens; limit > 0 && tokens >= int64(limit) {
+			return &quotaError{
+				Quota:      "daily_tokens",
+				Message:    fmt.Sprintf("daily token budget used up (%d of %d)", tokens, limit),
+				RetryAfter: untilTomorrow,
+			}, nil
+		}
+		if limit := s.cfg.QuotaDailyCost; limit > 0 && cost >= limit {
+			return &quotaError{
+				Quota:      "daily_cost",
+				Message:    fmt.Sprintf("daily cost budget used up ($%.4f of $%.4f)", cost, limit),
+				RetryAfter: untilTomorrow,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// lockUserRuns serializes run starts of one user until tx ends.
+func lockUserRuns(ctx context.Context, tx pgx.Tx, userID string) error {
+	_, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext('run_start:' || $1))`, userID)
+	return err
+}
+
+// recordRunStart counts a run toward the hourly quota. run_starts outlives
+// the run, so deleting chats does not reset the quota; entries past the hour
+// are no longer needed and are dropped here.
+func recordRunStart(ctx context.Context, tx pgx.Tx, userID, runID string) error {
+	if _, err := tx.Exec(ctx, `delete from run_starts where user_id=$1 and started_at < now() - interval '1 hour'`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `insert into run_starts(run_id, user_id) values ($1, $2)`, runID, userID)
+	return err
+}
+
+func writeQuotaErr(w http.ResponseWriter, qe *quotaError) {
+	secs := int(math.Ceil(qe.RetryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeJSON(w, http.StatusTooManyRequests, map[string]any{
+		"error":       qe.Message,
+		"quota":       qe.Quota,
+		"retry_after": secs,
+	})
+}
+
+// runBudgetExceeded reports whether the run has spent RunMaxTokens or
+// RunMaxCost, returning its totals for the budget.exceeded step.
+func (s *Server) runBudgetExceeded(ctx context.Context, runID string) (bool, usageTotals) {
+	if s.cfg.RunMaxTokens <= 0 && s.cfg.RunMaxCost <= 0 {
+		return false, usageTotals{}
+	}
+	var t usageTotals
+	if err := s.pool.QueryRow(ctx, `select total_tokens, cost from runs where id=$1`, runID).Scan(&t.TotalTokens, &t.Cost); err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("load run usage failed")
+		return false, usageTotals{}
+	}
+	if s.cfg.RunMaxTokens > 0 && t.TotalTokens >= int64(s.cfg.RunMaxTokens) {
+		return true, t
+	}
+	if s.cfg.RunMaxCost > 0 && t.Cost >= s.cfg.RunMaxCost {
+		return true, t
+	}
+	return false, t
+}
@@ -0,0 +1,279 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// errServerShutdown is the cancel cause for runs interrupted by a graceful
+// shutdown. Their jobs go back to the queue for another replica.
+var errServerShutdown = errors.New("server shutting down")
+
+type runJob struct {
+	RunID    string
+	Query    string
+	Model    string
+	Attempts int
+}
+
+// enqueueRun creates the job row for a run. It must be called inside the
+// transaction that inserts the run itself.
+func enqueueRun(ctx context.Context, tx pgx.Tx, runID, query, model string) error {
+	_, err := tx.Exec(ctx, `insert into run_jobs(run_id, query, model) values ($1,$2,$3)`, runID, query, model)
+	return err
+}
+
+// wakeWorkers nudges an idle local worker instead of waiting for the next poll.
+func (s *Server) wakeWorkers() {
+	select {
+	case s.queueWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunQueue runs the worker pool until ctx is done. On shutdown in-flight runs
+// are interrupted and their jobs requeued; RunQueue returns once they are.
+func (s *Server) RunQueue(ctx context.Context) {
+	host, _ := os.Hostname()
+	workerID := fmt.Sprintf("%s/%d/%s", host, os.Getpid(), uuid.New().String()[:8])
+
+	// Runs must outlive ctx long enough to notice why they were stopped.
+	runCtx, cancelRuns := context.WithCancelCause(context.Background())
+	defer cancelRuns(nil)
+	go func() {
+		<-ctx.Done()
+		cancelRuns(errServerShutdown)
+	}()
+
+	s.recoverOrphanedRuns(ctx)
+
+	workers := s.cfg.RunWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	s.logger.Info().Str("worker_id", workerID).Int("workers", workers).Msg("run queue started")
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runWorker(ctx, runCtx, workerID)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.cfg.RunHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.recoverOrphanedRuns(ctx)
+			}
+		}
+	}()
+
+	wg.Wait()
+	s.logger.Info().Str("worker_id", workerID).Msg("run queue stopped")
+}
+
+func (s *Server) runWorker(ctx, runCtx context.Context, workerID string) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, ok, err := s.claimRunJob(ctx, workerID)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error().Err(err).Msg("claim run job failed")
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.queueWake:
+			case <-time.After(s.cfg.RunQueuePollInterval):
+			}
+			continue
+		}
+		s.executeRunJob(runCtx, job, workerID)
+	}
+}
+
+func (s *Server) claimRunJob(ctx context.Context, workerID string) (runJob, bool, error) {
+	var job runJob
+	err := s.pool.QueryRow(
+		ctx,
+		`update run_jobs set status='running', locked_by=$1, locked_at=now(), heartbeat_at=now(),
+			attempts=attempts+1, updated_at=now()
+		 where run_id = (
+			select run_id from run_jobs
+			where status='queued' and available_at <= now()
+			order by created_at
+			for update skip locked
+			limit 1
+		 )
+		 returning run_id, query, model, attempts`,
+		workerID,
+	).Scan(&job.RunID, &job.Query, &job.Model, &job.Attempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return runJob{}, false, nil
+		}
+		return runJob{}, false, err
+	}
+	return job, true, nil
+}
+
+func (s *Server) executeRunJob(runCtx context.Context, job runJob, workerID string) {
+	bg := context.WithoutCancel(runCtx)
+
+	result, err := s.pool.Exec(bg, `update runs set status='running' where id=$1 and status='queued'`, job.RunID)
+	if err != nil || result.RowsAffected() == 0 {
+		// cancelled while queued, or gone
+		_, _ = s.pool.Exec(bg, `update run_jobs set status='done', updated_at=now() where run_id=$1`, job.RunID)
+		return
+	}
+
+	if job.Attempts > 1 {
+		// The pipeline starts over: drop what the lost attempt fetched and
+		// tell clients to discard the answer it had streamed so far.
+		if _, err := s.pool.Exec(bg, `delete from sources where run_id=$1`, job.RunID); err != nil {
+			s.logger.Warn().Err(err).Str("run_id", job.RunID).Msg("clear stale sources failed")
+		}
+		s.publishAnswerReset(job.RunID)
+		s.publishStep(bg, job.RunID, "run.resumed", "Resumed", map[string]any{"attempt": job.Attempts})
+	}
+
+	hbCtx, stopHeartbeat := context.WithCancel(bg)
+	go s.heartbeatRunJob(hbCtx, job.RunID, workerID)
+	s.runPipeline(runCtx, job.RunID, job.Query, job.Model)
+	stopHeartbeat()
+
+	if errors.Is(context.Cause(runCtx), errServerShutdown) {
+		s.requeueRunJob(bg, job.RunID, "backend shutdown")
+		return
+	}
+	_, _ = s.pool.Exec(bg, `update run_jobs set status='done', locked_by=null, updated_at=now() where run_id=$1`, job.RunID)
+}
+
+func (s *Server) heartbeatRunJob(ctx context.Context, runID, workerID string) {
+	ticker := time.NewTicker(s.cfg.RunHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = s.pool.Exec(ctx, `update run_jobs set heartbeat_at=now() where run_id=$1 and locked_by=$2`, runID, workerID)
+		}
+	}
+}
+
+func (s *Server) requeueRunJob(ctx context.Context, runID, reason string) {
+	_, _ = s.pool.Exec(ctx, `update run_jobs set status='queued', locked_by=null, available_at=now(), updated_at=now() where run_id=$1`, runID)
+	_, _ = s.pool.Exec(ctx, `update runs set status='queued' where id=$1 and status='running'`, runID)
+	s.publishStep(ctx, runID, "run.requeued", "Requeued", map[string]any{"reason": reason})
+	s.logger.Info().Str("run_id", runID).Str("reason", reason).Msg("run requeued")
+}
+
+// recoverOrphanedRuns requeues jobs whose worker stopped heartbeating and
+// fails them once RunMaxAttempts is used up. Runs left in 'running' without
+// a job row (started before the queue existed) are failed outright.
+func (s *Server) recoverOrphanedRuns(ctx context.Context) {
+	staleAfter := s.cfg.RunStaleAfter.Seconds()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(
+		ctx,
+		`select run_id, attempts from run_jobs
+		 where status='running' and heartbeat_at < now() - make_interval(secs => $1)
+		 for update skip locked`,
+		staleAfter,
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("scan orphaned runs failed")
+		return
+	}
+	var stale []runJob
+	for rows.Next() {
+		var job runJob
+		if err := rows.Scan(&job.RunID, &job.Attempts); err != nil {
+			rows.Close()
+			return
+		}
+		stale = append(stale, job)
+	}
+	rows.Close()
+
+	var requeued, failed []string
+	for _, job := range stale {
+		if job.Attempts < s.cfg.RunMaxAttempts {
+			_, err = tx.Exec(ctx, `update run_jobs set status='queued', locked_by=null, available_at=now(), updated_at=now() where run_id=$1`, job.RunID)
+			if err == nil {
+				_, err = tx.Exec(ctx, `update runs set status='queued' where id=$1 and status='running'`, job.RunID)
+			}
+			requeued = append(requeued, job.RunID)
+		} else {
+			_, err = tx.Exec(ctx, `update run_jobs set status='failed', locked_by=null, updated_at=now() where run_id=$1`, job.RunID)
+			if err == nil {
+				_, err = tx.Exec(
+					ctx,
+					`update runs set status='failed', finished_at=now(), error=$2 where id=$1 and status in ('queued','running')`,
+					job.RunID,
+					fmt.Sprintf("interrupted: worker lost after %d attempts", job.Attempts),
+				)
+			}
+			failed = append(failed, job.RunID)
+		}
+		if err != nil {
+			s.logger.Error().Err(err).Str("run_id", job.RunID).Msg("recover orphaned run failed")
+			return
+		}
+	}
+
+	legacy, err := tx.Exec(
+		ctx,
+		`update runs set status='failed', finished_at=now(), error='interrupted by backend restart'
+		 where status='running' and not exists (select 1 from run_jobs j where j.run_id=runs.id)`,
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("fail legacy orphaned runs failed")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return
+	}
+
+	for _, runID := range requeued {
+		s.publishStep(ctx, runID, "run.requeued", "Requeued", map[string]any{"reason": "worker lost"})
+	}
+	for _, runID := range failed {
+		s.publishRunError(runID, "interrupted: worker lost")
+	}
+	if len(requeued) > 0 {
+		s.wakeWorkers()
+	}
+	if len(requeued)+len(failed) > 0 || legacy.RowsAffected() > 0 {
+		s.logger.Warn().
+			Int("requeued", len(requeued)).
+			Int("failed", len(failed)).
+			Int64("legacy_failed", legacy.RowsAffected()).
+			Msg("orphaned runs recovered")
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,11 +21,14 @@ type runStartReq struct {
 	ChatID string `json:"chat_id"`
 	Query  string `json:"query"`
 	Model  string `json:"model"`
+	// SpaceID files a new chat in a space; ignored with ChatID.
+	SpaceID string `json:"space_id"`
 }
 
 type runStartResp struct {
-	ChatID string `json:"chat_id"`
-	RunID  string `json:"run_id"`
+	ChatID    string `json:"chat_id"`
+	RunID     string `json:"run_id"`
+	MessageID string `json:"message_id,omitempty"`
 }
 
 type sseHub struct {
@@ -32,58 +38,61 @@ type sseHub struct {
 
 type runBroadcaster struct {
 	mu   sync.Mutex
-	subs map[chan []byte]struct{}
+	subs map[chan runEvent]struct{}
 }
 
-func (b *runBroadcaster) subscribe() chan []byte {
+func (b *runBroadcaster) subscribe() chan runEvent {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	ch := make(chan []byte, 64)
+	ch := make(chan runEvent, 256)
 	if b.subs == nil {
-		b.subs = map[chan []byte]struct{}{}
+		b.subs = map[chan runEvent]struct{}{}
 	}
 	b.subs[ch] = struct{}{}
 	return ch
 }
 
-func (b *runBroadcaster) unsubscribe(ch chan []byte) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	delete(b.subs, ch)
-	close(ch)
-}
-
-func (b *runBroadcaster) publish(payload []byte) {
+func (b *runBroadcaster) publish(ev runEvent) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	for ch := range b.subs {
 		select {
-		case ch <- payload:
+		case ch <- ev:
 		default:
-			// drop if slow
+			// Too slow: drop the subscriber instead of the event. The client
+			// reconnects with Last-Event-ID and resumes without a gap.
+			delete(b.subs, ch)
+			close(ch)
 		}
 	}
 }
 
-var globalHub = &sseHub{pubs: map[string]*runBroadcaster{}}
+func newSSEHub() *sseHub {
+	return &sseHub{pubs: map[string]*runBroadcaster{}}
+}
 
-func (h *sseHub) get(runID string) *runBroadcaster {
+func (h *sseHub) subscribe(runID string) chan runEvent {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	b, ok := h.pubs[runID]
 	if !ok {
-		b = &runBroadcaster{subs: map[chan []byte]struct{}{}}
+		b = &runBroadcaster{subs: map[chan runEvent]struct{}{}}
 		h.pubs[runID] = b
 	}
-	return b
+	return b.subscribe()
 }
 
-func (h *sseHub) subscribe(runID string) chan []byte {
-	b := h.get(runID)
-	return b.subscribe()
+// deliver hands an event to local subscribers of its run.
+func (h *sseHub) deliver(ev runEvent) {
+	h.mu.Lock()
+	b := h.pubs[ev.RunID]
+	h.mu.Unlock()
+	if b != nil {
+		b.publish(ev)
+	}
 }
 
-func (h *sseHub) unsubscribe(runID string, ch chan []byte) {
+func (h *sseHub) unsubscribe(runID string, ch chan runEvent) {
 	h.mu.Lock()
 	b := h.pubs[runID]
 	h.mu.Unlock()
@@ -113,16 +122,6 @@ func (h *sseHub) unsubscribe(runID string, ch chan []byte) {
 	h.mu.Unlock()
 }
 
-func (h *sseHub) publish(runID string, payload []byte) {
-	h.mu.Lock()
-	b := h.pubs[runID]
-	h.mu.Unlock()
-	if b == nil {
-		return
-	}
-	b.publish(payload)
-}
-
 func (s *Server) handleRunStart(w http.ResponseWriter, r *http.Request) {
 	user := userFromCtx(r.Context())
 	if user == nil {
@@ -143,20 +142,30 @@ func (s *Server) handleRunStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	model := strings.TrimSpace(req.Model)
-	if model == "" {
-		model = user.PreferredModel
-	}
-
 	chatID := strings.TrimSpace(req.ChatID)
-	if chatID == "" {
-		chatID = uuid.New().String()
-		_, err := s.pool.Exec(r.Context(), `insert into chats(id,user_id,title) values ($1,$2,$3)`, chatID, user.ID, q)
-		if err != nil {
-			s.logger.Error().Err(err).Msg("create chat failed")
-			writeErr(w, http.StatusInternalServerError, fmt.Sprintf("create chat: %v", err))
+	var spaceID *string
+	if id := strings.TrimSpace(req.SpaceID); id != "" && chatID == "" {
+		if !s.checkSpaceParam(w, r, user.ID, id) {
 			return
 		}
+		spaceID = &id
+	}
+
+	spaceModel := ""
+	if spaceID != nil {
+		spaceModel = s.spaceDefaultModel(r.Context(), user.ID, "", *spaceID)
+	} else if chatID != "" {
+		spaceModel = s.spaceDefaultModel(r.Context(), user.ID, chatID, "")
+	}
+	model, ok := s.resolveRunModel(user, req.Model, spaceModel)
+	if !ok {
+		writeErr(w, http.StatusBadRequest, "unknown model")
+		return
+	}
+
+	newChat := chatID == ""
+	if newChat {
+		chatID = uuid.New().String()
 	} else {
 		var exists string
 		if err := s.pool.QueryRow(
@@ -170,31 +179,176 @@ func (s *Server) handleRunStart(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	runID := uuid.New().String()
-	_, err := s.pool.Exec(r.Context(), `insert into runs(id, chat_id, user_id, model, status) values ($1,$2,$3,$4,'running')`, runID, chatID, user.ID, model)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("create run failed")
-		writeErr(w, http.StatusInternalServerError, fmt.Sprintf("create run: %v", err))
+	run := queuedRun{
+		RunID:       uuid.New().String(),
+		ChatID:      chatID,
+		NewChat:     newChat,
+		SpaceID:     spaceID,
+		UserID:      user.ID,
+		Model:       model,
+		Query:       q,
+		NewMessage:  true,
+		AfterActive: true,
+	}
+	if err := s.createQueuedRun(r.Context(), &run); err != nil {
+		s.writeRunCreateErr(w, user, err)
 		return
 	}
 
-	_, _ = s.pool.Exec(r.Context(), `insert into messages(chat_id,user_id,role,content,run_id) values ($1,$2,'user',$3,$4)`, chatID, user.ID, q, runID)
-	_, _ = s.pool.Exec(r.Context(), `update chats set updated_at=now() where id=$1`, chatID)
+	s.logger.Info().Str("run_id", run.RunID).Str("chat_id", chatID).Str("model", model).Msg("run queued")
+	s.wakeWorkers()
+
+	writeJSON(w, http.StatusOK, runStartResp{ChatID: chatID, RunID: run.RunID, MessageID: run.MessageID})
+}
 
-	s.logger.Info().Str("run_id", runID).Str("chat_id", chatID).Str("model", model).Msg("run started")
+// resolveRunModel validates an explicitly requested model. Without one it
+// uses fallback, then the user's preferred model, then the default.
+func (s *Server) resolveRunModel(user *User, requested, fallback string) (string, bool) {
+	if model := strings.TrimSpace(requested); model != "" {
+		_, ok := s.cfg.Model(model)
+		return model, ok
+	}
+	for _, model := range []string{fallback, user.PreferredModel} {
+		if _, ok := s.cfg.Model(model); ok && model != "" {
+			return model, true
+		}
+	}
+	// the preferred model was removed from config.yaml
+	return s.cfg.DefaultModel(), true
+}
 
-	go s.runPipeline(context.Background(), runID, q, model)
+// writeRunCreateErr answers a failed createQueuedRun: 429 for a quota
+// refusal, 500 otherwise.
+func (s *Server) writeRunCreateErr(w http.ResponseWriter, user *User, err error) {
+	var qe *quotaError
+	if errors.As(err, &qe) {
+		s.logger.Info().Str("user_id", user.ID).Str("quota", qe.Quota).Msg("run refused by quota")
+		writeQuotaErr(w, qe)
+		return
+	}
+	s.logger.Error().Err(err).Msg("create run failed")
+	writeErr(w, http.StatusInternalServerError, fmt.Sprintf("create run: %v", err))
+}
 
-	writeJSON(w, http.StatusOK, runStartResp{ChatID: chatID, RunID: runID})
+// queuedRun describes a run to create. With NewChat the chat ChatID is
+// created first, titled by Query and filed under SpaceID. With NewMessage the
+// user message holding Query is created under ParentID, or under the chat's
+// active message when AfterActive is set; otherwise MessageID names the
+// existing user message the run answers again.
+type queuedRun struct {
+	RunID       string
+	ChatID      string
+	NewChat     bool
+	SpaceID     *string
+	UserID      string
+	Model       string
+	Query       string
+	MessageID   string
+	ParentID    *string
+	NewMessage  bool
+	AfterActive bool
+}
+
+// createQueuedRun checks the user's quotas and inserts the run, its user
+// message and its queue job in one transaction, making the user message the
+// chat's active branch. A quota refusal is returned as *quotaError.
+func (s *Server) createQueuedRun(ctx context.Context, run *queuedRun) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockUserRuns(ctx, tx, run.UserID); err != nil {
+		return err
+	}
+	qe, err := s.checkRunQuota(ctx, tx, run.UserID)
+	if err != nil {
+		return err
+	}
+	if qe != nil {
+		return qe
+	}
+	if run.NewChat {
+		if _, err := tx.Exec(ctx, `insert into chats(id,user_id,title,space_id) values ($1,$2,$3,$4)`, run.ChatID, run.UserID, run.Query, run.SpaceID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `insert into runs(id, chat_id, user_id, model, status) values ($1,$2,$3,$4,'queued')`, run.RunID, run.ChatID, run.UserID, run.Model); err != nil {
+		return err
+	}
+	if err := recordRunStart(ctx, tx, run.UserID, run.RunID); err != nil {
+		return err
+	}
+	if run.NewMessage {
+		if run.AfterActive {
+			if err := tx.QueryRow(ctx, `select active_message_id from chats where id=$1 for update`, run.ChatID).Scan(&run.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := tx.QueryRow(
+			ctx,
+			`insert into messages(chat_id, user_id, role, content, run_id, parent_message_id) values ($1,$2,'user',$3,$4,$5) returning id`,
+			run.ChatID,
+			run.UserID,
+			run.Query,
+			run.RunID,
+			run.ParentID,
+		).Scan(&run.MessageID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `update runs set user_message_id=$2 where id=$1`, run.RunID, run.MessageID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `update chats set active_message_id=$2, updated_at=now() where id=$1`, run.ChatID, run.MessageID); err != nil {
+		return err
+	}
+	if err := enqueueRun(ctx, tx, run.RunID, run.Query, run.Model); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
 	runID := chi.URLParam(r, "runID")
 	if runID == "" {
 		writeErr(w, http.StatusBadRequest, "runID is required")
 		return
 	}
 
+	var owned bool
+	if err := s.pool.QueryRow(
+		r.Context(),
+		`select exists(select 1 from runs where id=$1 and user_id=$2)`,
+		runID,
+		user.ID,
+	).Scan(&owned); err != nil || !owned {
+		writeErr(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	lastID := int64(0)
+	rawLastID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if rawLastID == "" {
+		rawLastID = strings.TrimSpace(r.URL.Query().Get("last_event_id"))
+	}
+	if rawLastID != "" {
+		v, err := strconv.ParseInt(rawLastID, 10, 64)
+		if err != nil || v < 0 {
+			writeErr(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+		lastID = v
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -205,22 +359,22 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sub := globalHub.subscribe(runID)
-	defer globalHub.unsubscribe(runID, sub)
+	// Subscribe before replaying so nothing committed in between is missed;
+	// live events already covered by the replay are skipped by sequence.
+	sub := s.events.subscribe(runID)
+	defer s.events.unsubscribe(runID, sub)
 
-	// replay existing steps
-	rows, err := s.pool.Query(r.Context(), `select type, title, payload, created_at from run_steps where run_id=$1 order by created_at asc`, runID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var typ, title string
-			var payload []byte
-			var created time.Time
-			_ = rows.Scan(&typ, &title, &payload, &created)
-			s.writeSSE(w, "step", map[string]any{"type": typ, "title": title, "payload": json.RawMessage(payload), "created_at": created})
-		}
-		flusher.Flush()
+	replayed, err := s.replayRunEvents(r.Context(), w, runID, lastID)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("replay run events failed")
+	}
+	if replayed == 0 && lastID == 0 {
+		s.replayLegacySteps(r.Context(), w, runID)
 	}
+	if replayed < lastID {
+		replayed = lastID
+	}
+	flusher.Flush()
 
 	keepAlive := time.NewTicker(15 * time.Second)
 	defer keepAlive.Stop()
@@ -231,8 +385,16 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 		case <-r.Context().Done():
 			_ = bufw.Flush()
 			return
-		case payload := <-sub:
-			_, _ = bufw.Write(payload)
+		case ev, ok := <-sub:
+			if !ok {
+				// dropped as a slow subscriber; the client resumes from its last id
+				_ = bufw.Flush()
+				return
+			}
+			if ev.Seq > 0 && ev.Seq <= replayed {
+				continue
+			}
+			_, _ = bufw.Write(ev.Frame)
 			_ = bufw.Flush()
 			flusher.Flush()
 		case <-keepAlive.C:
@@ -243,6 +405,49 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// replayRunEvents writes stored events after lastID and returns the highest
+// sequence written (0 when there was nothing to replay).
+func (s *Server) replayRunEvents(ctx context.Context, w http.ResponseWriter, runID string, lastID int64) (int64, error) {
+	rows, err := s.pool.Query(ctx, `select seq, event, data from run_events where run_id=$1 and seq > $2 order by seq asc`, runID, lastID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var maxSeq int64
+	for rows.Next() {
+		var seq int64
+		var event string
+		var data []byte
+		if err := rows.Scan(&seq, &event, &data); err != nil {
+			return maxSeq, err
+		}
+		_, _ = w.Write(sseFrame(seq, event, data))
+		maxSeq = seq
+	}
+	return maxSeq, rows.Err()
+}
+
+// replayLegacySteps covers runs recorded before run_events existed.
+func (s *Server) replayLegacySteps(ctx context.Context, w http.ResponseWriter, runID string) {
+	var hasEvents bool
+	if err := s.pool.QueryRow(ctx, `select exists(select 1 from run_events where run_id=$1)`, runID).Scan(&hasEvents); err != nil || hasEvents {
+		return
+	}
+	rows, err := s.pool.Query(ctx, `select type, title, payload, created_at from run_steps where run_id=$1 order by created_at asc`, runID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var typ, title string
+		var payload []byte
+		var created time.Time
+		_ = rows.Scan(&typ, &title, &payload, &created)
+		s.writeSSE(w, "step", map[string]any{"type": typ, "title": title, "payload": json.RawMessage(payload), "created_at": created})
+	}
+}
+
 func (s *Server) writeSSE(w http.ResponseWriter, event string, data any) {
 	b, _ := json.Marshal(data)
 	_, _ = w.Write([]byte("event: " + event + "\n"))
@@ -251,29 +456,127 @@ func (s *Server) writeSSE(w http.ResponseWriter, event string, data any) {
 	_, _ = w.Write([]byte("\n\n"))
 }
 
+func sseFrame(seq int64, event string, data []byte) []byte {
+	var b strings.Builder
+	if seq > 0 {
+		b.WriteString("id: " + strconv.FormatInt(seq, 10) + "\n")
+	}
+	b.WriteString("event: " + event + "\n")
+	b.WriteString("data: ")
+	b.Write(data)
+	b.WriteString("\n\n")
+	return []byte(b.String())
+}
+
+// emitEvent stores an event under the run's next sequence number and
+// publishes it. Emission for a run is serialized so sequence order matches
+// delivery order.
+func (s *Server) emitEvent(ctx context.Context, runID, event string, data any) {
+	body, _ := json.Marshal(data)
+
+	lock := s.emitLock(runID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var seq int64
+	err := s.pool.QueryRow(
+		context.WithoutCancel(ctx),
+		`with n as (update runs set event_seq=event_seq+1 where id=$1 returning event_seq)
+		 insert into run_events(run_id, seq, event, data)
+		 select $1, event_seq, $2, $3 from n
+		 returning seq`,
+		runID,
+		event,
+		body,
+	).Scan(&seq)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Str("event", event).Msg("store run event failed")
+	}
+	s.events.publish(runEvent{RunID: runID, Seq: seq, Frame: sseFrame(seq, event, body)})
+}
+
+func (s *Server) emitLock(runID string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(runID))
+	return &s.emitLocks[h.Sum32()%uint32(len(s.emitLocks))]
+}
+
 func (s *Server) publishStep(ctx context.Context, runID, typ, title string, payload any) {
 	jb, _ := json.Marshal(payload)
 	_, _ = s.pool.Exec(ctx, `insert into run_steps(run_id,type,title,payload) values ($1,$2,$3,$4)`, runID, typ, title, jb)
 
-	frame, _ := json.Marshal(map[string]any{"type": typ, "title": title, "payload": payload, "created_at": time.Now()})
-	sse := []byte("event: step\n" + "data: " + string(frame) + "\n\n")
-	globalHub.publish(runID, sse)
+	s.emitEvent(ctx, runID, "step", map[string]any{"type": typ, "title": title, "payload": json.RawMessage(jb), "created_at": time.Now()})
 }
 
 func (s *Server) publishAnswerDelta(runID string, delta string) {
-	frame, _ := json.Marshal(map[string]any{"delta": delta})
-	sse := []byte("event: answer.delta\n" + "data: " + string(frame) + "\n\n")
-	globalHub.publish(runID, sse)
+	s.emitEvent(context.Background(), runID, "answer.delta", map[string]any{"delta": delta})
+}
+
+const (
+	answerDeltaBatchBytes    = 512
+	answerDeltaBatchInterval = 150 * time.Millisecond
+)
+
+// deltaBatcher coalesces streamed tokens into fewer answer.delta events, so a
+// run stores and notifies one event per batch rather than one per token.
+type deltaBatcher struct {
+	emit    func(string)
+	pending strings.Builder
+	last    time.Time
+}
+
+func newDeltaBatcher(emit func(string)) *deltaBatcher {
+	return &deltaBatcher{emit: emit, last: time.Now()}
+}
+
+func (b *deltaBatcher) add(delta string) {
+	b.pending.WriteString(delta)
+	if b.pending.Len() >= answerDeltaBatchBytes || time.Since(b.last) >= answerDeltaBatchInterval {
+		b.flush()
+	}
+}
+
+func (b *deltaBatcher) flush() {
+	b.last = time.Now()
+	if b.pending.Len() == 0 {
+		return
+	}
+	b.emit(b.pending.String())
+	b.pending.Reset()
+}
+
+// discard drops text that is about to be reset anyway.
+func (b *deltaBatcher) discard() {
+	b.pending.Reset()
+}
+
+// publishAnswerReset tells clients to drop streamed text that turned out not
+// to be the final answer (for example content followed by tool calls).
+func (s *Server) publishAnswerReset(runID string) {
+	s.emitEvent(context.Background(), runID, "answer.reset", map[string]any{})
+}
+
+func (s *Server) publishFinal(runID string, result agentResult) {
+	citations := result.Citations
+	if citations == nil {
+		citations = []citation{}
+	}
+	payload := map[string]any{
+		"answer":    result.Answer,
+		"model":     result.Model,
+		"citations": citations,
+		"degraded":  result.Degraded,
+	}
+	if result.Degraded {
+		payload["degraded_reason"] = result.DegradedReason
+	}
+	s.emitEvent(context.Background(), runID, "answer.final", payload)
 }
 
-func (s *Server) publishFinal(runID string, answer string, model string) {
-	frame, _ := json.Marshal(map[string]any{"answer": answer, "model": model})
-	sse := []byte("event: answer.final\n" + "data: " + string(frame) + "\n\n")
-	globalHub.publish(runID, sse)
+func (s *Server) publishRunCancelled(runID string) {
+	s.emitEvent(context.Background(), runID, "run.cancelled", map[string]any{"status": "cancelled"})
 }
 
 func (s *Server) publishRunError(runID string, message string) {
-	frame, _ := json.Marshal(map[string]any{"error": message})
-	sse := []byte("event: run.error\n" + "data: " + string(frame) + "\n\n")
-	globalHub.publish(runID, sse)
+	s.emitEvent(context.Background(), runID, "run.error", map[string]any{"error": message})
 }
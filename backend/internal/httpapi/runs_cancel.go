@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errRunCancelled is the cancel cause used when a user stops a run.
+var errRunCancelled = errors.New("run cancelled")
+
+// runRegistry tracks cancel functions of runs executing in this process.
+type runRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+}
+
+func newRunRegistry() *runRegistry {
+	return &runRegistry{cancels: map[string]context.CancelCauseFunc{}}
+}
+
+func (r *runRegistry) add(runID string, cancel context.CancelCauseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[runID] = cancel
+}
+
+func (r *runRegistry) remove(runID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, runID)
+}
+
+// cancel stops a local run and reports whether it was found.
+func (r *runRegistry) cancel(runID string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[runID]
+	r.mu.Unlock()
+	if ok {
+		cancel(errRunCancelled)
+	}
+	return ok
+}
+
+// watchRunCancel polls the run status so that a cancel issued on another
+// replica also stops the pipeline running here.
+func (s *Server) watchRunCancel(ctx context.Context, runID string, cancel context.CancelCauseFunc) {
+	if s.cfg.RunCancelPollInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.RunCancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var status string
+			if err := s.pool.QueryRow(ctx, `select status from runs where id=$1`, runID).Scan(&status); err != nil {
+				continue
+			}
+			if status == "cancelled" {
+				cancel(errRunCancelled)
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) handleRunCancel(w http.ResponseWriter, r *http.Request) {
+	user := userFromCtx(r.Context())
+	if user == nil {
+		writeErr(w, http.StatusUnauthorized, "auth required")
+		return
+	}
+
+	runID := chi.URLParam(r, "runID")
+	if runID == "" {
+		writeErr(w, http.StatusBadRequest, "runID is required")
+		return
+	}
+
+	var status string
+	if err := s.pool.QueryRow(
+		r.Context(),
+		`select status from runs where id=$1 and user_id=$2`,
+		runID,
+		user.ID,
+	).Scan(&status); err != nil {
+		writeErr(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	result, err := s.pool.Exec(
+		r.Context(),
+		`update runs set status='cancelled', finished_at=now(), error='cancelled by user' where id=$1 and status in ('queued','running')`,
+		runID,
+	)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.RowsAffected() == 0 {
+		writeErr(w, http.StatusConflict, "run is not running")
+		return
+	}
+
+	// A running pipeline announces its own cancellation, locally or on the
+	// replica whose watcher picks the status up. Queued runs have no
+	// pipeline yet, so announce those here.
+	if !s.activeRuns.cancel(runID) && status == "queued" {
+		s.publishRunCancelled(runID)
+	}
+
+	s.logger.Info().Str("run_id", runID).Msg("run cancel requested")
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "status": "cancelled"})
+}
@@ -0,0 +1,212 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+// SearchProvider is a web search backend. Implementations only query their
+// backend and return normalized results; publishing steps and storing
+// queries/results happens once in runSearch.
+type SearchProvider interface {
+	Name() string
+	Search(ctx context.Context, req searchRequest) ([]searchResult, error)
+}
+
+// searchRequest is a normalized search tool call. Category is one of
+// searchCategories and TimeRange, when set, one of searchTimeRanges.
+type searchRequest struct {
+	Query      string
+	QueryIndex int
+	Category   string
+	TimeRange  string
+	Language   string
+	Site       string
+}
+
+var (
+	searchCategories = []string{"general", "news", "science", "it", "images", "videos", "files"}
+	searchTimeRanges = []string{"day", "week", "month", "year"}
+	languageCodeRe   = regexp.MustCompile(`^[a-z]{2}(-[a-z]{2})?$`)
+)
+
+func newSearchRequest(args toolSearchArgs, queryIndex int) (searchRequest, error) {
+	req := searchRequest{
+		Query:      strings.TrimSpace(args.Query),
+		QueryIndex: queryIndex,
+		Category:   strings.ToLower(strings.TrimSpace(args.Category)),
+		TimeRange:  strings.ToLower(strings.TrimSpace(args.TimeRange)),
+		Language:   strings.ToLower(strings.TrimSpace(args.Language)),
+		Site:       strings.ToLower(strings.TrimSpace(args.Site)),
+	}
+	if req.Category == "" {
+		req.Category = "general"
+	}
+	if !slices.Contains(searchCategories, req.Category) {
+		return searchRequest{}, fmt.Errorf("unsupported category %q (use one of %s)", req.Category, strings.Join(searchCategories, ", "))
+	}
+	if req.TimeRange != "" && !slices.Contains(searchTimeRanges, req.TimeRange) {
+		return searchRequest{}, fmt.Errorf("unsupported time_range %q (use one of %s)", req.TimeRange, strings.Join(searchTimeRanges, ", "))
+	}
+	if req.Language != "" && !languageCodeRe.MatchString(req.Language) {
+		return searchRequest{}, fmt.Errorf("unsupported language %q", req.Language)
+	}
+	if req.Site != "" {
+		site := strings.TrimPrefix(req.Site, "site:")
+		if parsed, err := url.Parse(site); err == nil && parsed.Hostname() != "" {
+			site = parsed.Hostname()
+		}
+		site = strings.Trim(site, "/ ")
+		if site == "" || strings.ContainsAny(site, " /") {
+			return searchRequest{}, fmt.Errorf("unsupported site %q", req.Site)
+		}
+		req.Site = site
+	}
+	return req, nil
+}
+
+// fullQuery is the query text with the site restriction applied.
+func (r searchRequest) fullQuery() string {
+	if r.Site == "" {
+		return r.Query
+	}
+	return r.Query + " site:" + r.Site
+}
+
+func (r searchRequest) stepPayload() map[string]any {
+	payload := map[string]any{
+		"query":       r.Query,
+		"category":    r.Category,
+		"query_index": r.QueryIndex,
+	}
+	if r.TimeRange != "" {
+		payload["time_range"] = r.TimeRange
+	}
+	if r.Language != "" {
+		payload["language"] = r.Language
+	}
+	if r.Site != "" {
+		payload["site"] = r.Site
+	}
+	return payload
+}
+
+// SearchProviderFactory builds a provider from the loaded config.
+type SearchProviderFactory func(cfg config.Config, logger zerolog.Logger) (SearchProvider, error)
+
+var (
+	searchProvidersMu sync.RWMutex
+	searchProviders   = map[string]SearchProviderFactory{}
+)
+
+// RegisterSearchProvider makes a provider selectable through SEARCH_PROVIDER.
+// Names are case-insensitive; registering a name twice panics.
+func RegisterSearchProvider(factory SearchProviderFactory, names ...string) {
+	searchProvidersMu.Lock()
+	defer searchProvidersMu.Unlock()
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, dup := searchProviders[key]; dup {
+			panic("search provider registered twice: " + key)
+		}
+		searchProviders[key] = factory
+	}
+}
+
+func lookupSearchProvider(name string) (SearchProviderFactory, bool) {
+	searchProvidersMu.RLock()
+	defer searchProvidersMu.RUnlock()
+	factory, ok := searchProviders[strings.ToLower(strings.TrimSpace(name))]
+	return factory, ok
+}
+
+func searchProviderNames() []string {
+	searchProvidersMu.RLock()
+	defer searchProvidersMu.RUnlock()
+	names := make([]string, 0, len(searchProviders))
+	for name := range searchProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// searchProvider builds the named provider, or SEARCH_PROVIDER when name is
+// empty.
+func (s *Server) searchProvider(name string) (SearchProvider, error) {
+	if strings.TrimSpace(name) == "" {
+		name = s.cfg.SearchProvider
+	}
+	if strings.TrimSpace(name) == "" {
+		name = "searxng"
+	}
+	factory, ok := lookupSearchProvider(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown search provider: %s (available: %s)", name, strings.Join(searchProviderNames(), ", "))
+	}
+	return factory(s.cfg, s.logger)
+}
+
+// runSearch runs one search tool call through the configured provider, or
+// the space's, and records it as search.query/search.results steps and
+// search_* rows. Results outside the space's domain lists are dropped.
+func (s *Server) runSearch(ctx context.Context, runID string, sp *space, req searchRequest, totalQueries int) ([]searchResult, error) {
+	provider, err := s.searchProvider(sp.searchProviderName())
+	if err != nil {
+		return nil, err
+	}
+
+	queryStep := req.stepPayload()
+	queryStep["total"] = totalQueries
+	queryStep["provider"] = provider.Name()
+	s.publishStep(ctx, runID, "search.query", "Search", queryStep)
+
+	var queryID string
+	if err := s.pool.QueryRow(ctx, `insert into search_queries(run_id, query, category) values ($1,$2,$3) returning id`, runID, req.Query, req.Category).Scan(&queryID); err != nil {
+		return nil, err
+	}
+
+	results, err := provider.Search(ctx, req)
+	if err != nil {
+		s.logger.Error().Err(err).Str("run_id", runID).Str("provider", provider.Name()).Msg("search failed")
+		return nil, err
+	}
+	filtered := 0
+	if sp != nil {
+		kept := results[:0]
+		for _, res := range results {
+			if sp.allowsURL(res.URL) {
+				kept = append(kept, res)
+			}
+		}
+		filtered = len(results) - len(kept)
+		results = kept
+	}
+
+	if err := s.storeSearchResults(ctx, queryID, results); err != nil {
+		s.logger.Error().Err(err).Str("run_id", runID).Msg("store search results failed")
+		return nil, err
+	}
+
+	resultsStep := req.stepPayload()
+	resultsStep["count"] = len(results)
+	resultsStep["total"] = totalQueries
+	resultsStep["provider"] = provider.Name()
+	resultsStep["results"] = normalizeResults(results)
+	if filtered > 0 {
+		resultsStep["filtered"] = filtered
+	}
+	s.publishStep(ctx, runID, "search.results", "Search results", resultsStep)
+
+	return results, nil
+}
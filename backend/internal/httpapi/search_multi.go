@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+// rrfK is the reciprocal rank fusion constant from Cormack et al.
+const rrfK = 60.0
+
+func init() {
+	RegisterSearchProvider(newMultiProvider, "multi")
+}
+
+type weightedProvider struct {
+	provider SearchProvider
+	weight   float64
+}
+
+// multiProvider queries several providers in parallel and merges their
+// rankings with weighted reciprocal rank fusion. A provider that fails or
+// times out is skipped; the call only fails if every provider does.
+type multiProvider struct {
+	providers []weightedProvider
+	timeout   time.Duration
+	logger    zerolog.Logger
+}
+
+func newMultiProvider(cfg config.Config, logger zerolog.Logger) (SearchProvider, error) {
+	m := &multiProvider{timeout: cfg.SearchMultiTimeout, logger: logger}
+	for _, name := range cfg.SearchMultiProviders {
+		if name == "multi" {
+			return nil, fmt.Errorf("SEARCH_MULTI_PROVIDERS cannot include multi")
+		}
+		factory, ok := lookupSearchProvider(name)
+		if !ok {
+			return nil, fmt.Errorf("SEARCH_MULTI_PROVIDERS: unknown provider %s", name)
+		}
+		provider, err := factory(cfg, logger)
+		if err != nil {
+			// e.g. serper without an API key: run with the rest
+			logger.Warn().Err(err).Str("provider", name).Msg("multi search: provider disabled")
+			continue
+		}
+		weight, ok := cfg.SearchMultiWeights[name]
+		if !ok {
+			weight = 1
+		}
+		m.providers = append(m.providers, weightedProvider{provider: provider, weight: weight})
+	}
+	if len(m.providers) == 0 {
+		return nil, fmt.Errorf("multi search: no usable providers in SEARCH_MULTI_PROVIDERS")
+	}
+	return m, nil
+}
+
+func (m *multiProvider) Name() string { return "multi" }
+
+func (m *multiProvider) Search(ctx context.Context, sr searchRequest) ([]searchResult, error) {
+	type providerResult struct {
+		results []searchResult
+		err     error
+	}
+	out := make([]providerResult, len(m.providers))
+
+	var wg sync.WaitGroup
+	for i, wp := range m.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pctx := ctx
+			if m.timeout > 0 {
+				var cancel context.CancelFunc
+				pctx, cancel = context.WithTimeout(ctx, m.timeout)
+				defer cancel()
+			}
+			results, err := wp.provider.Search(pctx, sr)
+			out[i] = providerResult{results: results, err: err}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type fused struct {
+		result searchResult
+		score  float64
+		raw    map[string]json.RawMessage
+	}
+	byURL := map[string]*fused{}
+	order := []string{}
+	var errs []string
+	for i, wp := range m.providers {
+		name := wp.provider.Name()
+		if out[i].err != nil {
+			m.logger.Warn().Err(out[i].err).Str("provider", name).Msg("multi search: provider failed")
+			errs = append(errs, name+": "+out[i].err.Error())
+			continue
+		}
+		for pos, res := range out[i].results {
+			key := res.Canonical
+			if key == "" {
+				key = canonicalizeURL(res.URL)
+			}
+			if key == "" {
+				key = res.URL
+			}
+			f, ok := byURL[key]
+			if !ok {
+				f = &fused{result: res, raw: map[string]json.RawMessage{}}
+				f.result.Canonical = key
+				f.result.Engines = nil
+				byURL[key] = f
+				order = append(order, key)
+			}
+			if _, seen := f.raw[name]; seen {
+				// duplicate URL within one provider's list: count its best rank only
+				continue
+			}
+			f.score += wp.weight / (rrfK + float64(pos+1))
+			f.raw[name] = res.Raw
+			f.result.Engines = append(f.result.Engines, name)
+			if f.result.Title == "" {
+				f.result.Title = res.Title
+			}
+			if len(res.Snippet) > len(f.result.Snippet) {
+				f.result.Snippet = res.Snippet
+			}
+		}
+	}
+	if len(errs) == len(m.providers) {
+		return nil, fmt.Errorf("multi search: all providers failed: %s", strings.Join(errs, "; "))
+	}
+
+	merged := make([]*fused, 0, len(order))
+	for _, key := range order {
+		merged = append(merged, byURL[key])
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].score > merged[j].score })
+
+	results := make([]searchResult, 0, len(merged))
+	for i, f := range merged {
+		res := f.result
+		res.Rank = i + 1
+		res.QueryIndex = sr.QueryIndex
+		res.Score = f.score
+		res.Engine = strings.Join(res.Engines, ",")
+		res.Raw, _ = json.Marshal(f.raw)
+		results = append(results, res)
+	}
+	return results, nil
+}
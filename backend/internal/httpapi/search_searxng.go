@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+func init() {
+	RegisterSearchProvider(newSearxProvider, "searxng", "searx")
+}
+
+type searxProvider struct {
+	baseURL string
+	client  *http.Client
+	logger  zerolog.Logger
+}
+
+func newSearxProvider(cfg config.Config, logger zerolog.Logger) (SearchProvider, error) {
+	return &searxProvider{
+		baseURL: cfg.SearxNGBaseURL,
+		client:  &http.Client{Timeout: cfg.SearchTimeout},
+		logger:  logger,
+	}, nil
+}
+
+func (p *searxProvider) Name() string { return "searxng" }
+
+func (p *searxProvider) Search(ctx context.Context, sr searchRequest) ([]searchResult, error) {
+	endpoint := strings.TrimRight(p.baseURL, "/") + "/search"
+	reqURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	q := reqURL.Query()
+	q.Set("format", "json")
+	q.Set("q", sr.fullQuery())
+	if sr.Category != "" {
+		q.Set("categories", sr.Category)
+	}
+	if sr.TimeRange != "" {
+		q.Set("time_range", sr.TimeRange)
+	}
+	if sr.Language != "" {
+		q.Set("language", sr.Language)
+	}
+	reqURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "gosearch-ai/0.1")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		p.logger.Error().Int("status", resp.StatusCode).Msg("searxng non-200")
+		return nil, fmt.Errorf("searxng status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Results []map[string]any `json:"results"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	results := make([]searchResult, 0, len(payload.Results))
+	rank := 1
+	for _, item := range payload.Results {
+		title, _ := item["title"].(string)
+		rawURL, _ := item["url"].(string)
+		content, _ := item["content"].(string)
+		engine, _ := item["engine"].(string)
+		if rawURL == "" {
+			continue
+		}
+		canonical := canonicalizeURL(rawURL)
+		rawJSON, _ := json.Marshal(item)
+		results = append(results, searchResult{
+			Title:      title,
+			URL:        rawURL,
+			Canonical:  canonical,
+			Snippet:    content,
+			Engine:     engine,
+			Raw:        rawJSON,
+			Rank:       rank,
+			QueryIndex: sr.QueryIndex,
+			Score:      scoreResult(rank, sr.QueryIndex, rawURL, title, content),
+		})
+		rank++
+	}
+	return results, nil
+}
@@ -0,0 +1,171 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"gosearch-ai/backend/internal/config"
+)
+
+func init() {
+	RegisterSearchProvider(newSerperProvider, "serper")
+}
+
+type serperProvider struct {
+	apiKey  string
+	baseURL string
+	num     int
+	hl      string
+	gl      string
+	client  *http.Client
+	logger  zerolog.Logger
+}
+
+func newSerperProvider(cfg config.Config, logger zerolog.Logger) (SearchProvider, error) {
+	if strings.TrimSpace(cfg.SerperAPIKey) == "" {
+		return nil, fmt.Errorf("SERPER_API_KEY is required for serper provider")
+	}
+	return &serperProvider{
+		apiKey:  cfg.SerperAPIKey,
+		baseURL: cfg.SerperBaseURL,
+		num:     cfg.SerperNum,
+		hl:      cfg.SerperHL,
+		gl:      cfg.SerperGL,
+		client:  &http.Client{Timeout: cfg.SearchTimeout},
+		logger:  logger,
+	}, nil
+}
+
+func (p *serperProvider) Name() string { return "serper" }
+
+// serperEndpoints maps search categories onto Serper verticals. Categories
+// without a dedicated vertical use web search; files narrows it to documents.
+var serperEndpoints = map[string]string{
+	"general": "/search",
+	"it":      "/search",
+	"files":   "/search",
+	"news":    "/news",
+	"science": "/scholar",
+	"images":  "/images",
+	"videos":  "/videos",
+}
+
+var serperTimeRanges = map[string]string{
+	"day":   "qdr:d",
+	"week":  "qdr:w",
+	"month": "qdr:m",
+	"year":  "qdr:y",
+}
+
+type serperItem struct {
+	Title    string `json:"title"`
+	Link     string `json:"link"`
+	Snippet  string `json:"snippet"`
+	Position int    `json:"position"`
+	Date     string `json:"date,omitempty"`
+	Source   string `json:"source,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+}
+
+func (p *serperProvider) Search(ctx context.Context, sr searchRequest) ([]searchResult, error) {
+	query := sr.fullQuery()
+	if sr.Category == "files" {
+		query += " (filetype:pdf OR filetype:doc OR filetype:docx OR filetype:xls OR filetype:ppt)"
+	}
+	payload := map[string]any{
+		"q":   query,
+		"num": p.num,
+		"hl":  p.hl,
+		"gl":  p.gl,
+	}
+	if sr.Language != "" {
+		payload["hl"] = sr.Language
+	}
+	if tbs, ok := serperTimeRanges[sr.TimeRange]; ok {
+		payload["tbs"] = tbs
+	}
+	body, _ := json.Marshal(payload)
+
+	path, ok := serperEndpoints[sr.Category]
+	if !ok {
+		path = "/search"
+	}
+	endpoint := strings.TrimRight(p.baseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("User-Agent", "gosearch-ai/0.1")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		p.logger.Error().Int("status", resp.StatusCode).Msg("serper non-200")
+		return nil, fmt.Errorf("serper status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	// Each vertical returns its items under a different key.
+	var payloadResp struct {
+		Organic []serperItem `json:"organic"`
+		News    []serperItem `json:"news"`
+		Images  []serperItem `json:"images"`
+		Videos  []serperItem `json:"videos"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&payloadResp); err != nil {
+		return nil, err
+	}
+	items := payloadResp.Organic
+	switch path {
+	case "/news":
+		items = payloadResp.News
+	case "/images":
+		items = payloadResp.Images
+	case "/videos":
+		items = payloadResp.Videos
+	}
+
+	results := make([]searchResult, 0, len(items))
+	for i, item := range items {
+		rawURL := strings.TrimSpace(item.Link)
+		if rawURL == "" {
+			continue
+		}
+		rank := item.Position
+		if rank <= 0 {
+			rank = i + 1
+		}
+		snippet := item.Snippet
+		if snippet == "" && item.Source != "" {
+			snippet = item.Source
+		}
+		canonical := canonicalizeURL(rawURL)
+		rawJSON, _ := json.Marshal(item)
+		results = append(results, searchResult{
+			Title:      item.Title,
+			URL:        rawURL,
+			Canonical:  canonical,
+			Snippet:    snippet,
+			Engine:     "serper",
+			Raw:        rawJSON,
+			Rank:       rank,
+			QueryIndex: sr.QueryIndex,
+			Score:      scoreResult(rank, sr.QueryIndex, rawURL, item.Title, snippet),
+		})
+	}
+	return results, nil
+}
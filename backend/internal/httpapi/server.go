@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -15,13 +16,32 @@ import (
 )
 
 type Server struct {
-	cfg    config.Config
-	pool   *pgxpool.Pool
-	logger zerolog.Logger
+	cfg        config.Config
+	pool       *pgxpool.Pool
+	logger     zerolog.Logger
+	activeRuns *runRegistry
+	queueWake  chan struct{}
+	events     eventBroker
+	emitLocks  [64]sync.Mutex
+
+	fetchPolicy *fetchPolicy
+	fetchClient *http.Client
+	fetchHosts  *hostLimiter
 }
 
 func NewServer(cfg config.Config, pool *pgxpool.Pool, logger zerolog.Logger) *Server {
-	return &Server{cfg: cfg, pool: pool, logger: logger}
+	policy := newFetchPolicy(cfg)
+	return &Server{
+		cfg:         cfg,
+		pool:        pool,
+		logger:      logger,
+		activeRuns:  newRunRegistry(),
+		queueWake:   make(chan struct{}, 1),
+		events:      newEventBroker(cfg, pool, logger),
+		fetchPolicy: policy,
+		fetchClient: newFetchClient(cfg, policy),
+		fetchHosts:  newHostLimiter(cfg.FetchPerHost),
+	}
 }
 
 func (s *Server) Router() http.Handler {
@@ -37,15 +57,41 @@ func (s *Server) Router() http.Handler {
 		_, _ = w.Write([]byte(`{"ok":true}`))
 	})
 
+	r.Post("/auth/register", s.handleRegister)
+	r.Post("/auth/login", s.handleLogin)
+	r.Post("/auth/refresh", s.handleRefresh)
+	r.Post("/auth/logout", s.handleLogout)
+	r.Get("/me", s.handleMe)
+	r.Get("/me/usage", s.handleMyUsage)
+
 	r.Get("/models", s.handleListModels)
 	r.Post("/runs/start", s.handleRunStart)
+	r.Post("/runs/{runID}/cancel", s.handleRunCancel)
 	r.Get("/runs/{runID}/stream", s.handleRunStream)
 	r.Get("/runs/{runID}/steps", s.handleListRunSteps)
 	r.Get("/runs/{runID}/sources", s.handleListRunSources)
+	r.Get("/runs/{runID}/usage", s.handleRunUsage)
+	r.Get("/search/library", s.handleLibrarySearch)
+	r.Get("/spaces", s.handleListSpaces)
+	r.Post("/spaces", s.handleCreateSpace)
+	r.Get("/spaces/{spaceID}", s.handleGetSpace)
+	r.Patch("/spaces/{spaceID}", s.handleUpdateSpace)
+	r.Delete("/spaces/{spaceID}", s.handleDeleteSpace)
 	r.Get("/chats", s.handleListChats)
 	r.Get("/chats/{chatID}", s.handleGetChat)
+	r.Patch("/chats/{chatID}", s.handleUpdateChat)
 	r.Delete("/chats/{chatID}", s.handleDeleteChat)
+	r.Post("/chats/bulk", s.handleBulkChats)
+	r.Post("/chats/import", s.handleImportChat)
+	r.Post("/chats/{chatID}/restore", s.handleRestoreChat)
+	r.Get("/chats/{chatID}/export", s.handleExportChat)
+	r.Get("/trash", s.handleListTrash)
+	r.Delete("/trash/{chatID}", s.handlePurgeChat)
 	r.Get("/chats/{chatID}/messages", s.handleListMessages)
+	r.Post("/messages/{messageID}/regenerate", s.handleRegenerateMessage)
+	r.Post("/messages/{messageID}/edit", s.handleEditMessage)
+	r.Get("/messages/{messageID}/siblings", s.handleListSiblings)
+	r.Post("/messages/{messageID}/activate", s.handleActivateMessage)
 	r.Get("/bookmarks", s.handleListBookmarks)
 	r.Post("/bookmarks/{chatID}", s.handleCreateBookmark)
 	r.Delete("/bookmarks/{chatID}", s.handleDeleteBookmark)
@@ -0,0 +1,303 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	passageTargetRunes = 700
+	passageMaxRunes    = 1200
+	passageMinRunes    = 80
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// pageSnippet is a passage of a fetched page kept as evidence for the answer.
+type pageSnippet struct {
+	ID      string  `json:"id"`
+	Quote   string  `json:"quote"`
+	Context string  `json:"context,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+type passage struct {
+	Text    string
+	Heading string
+	Pos     int
+	Score   float64
+}
+
+// toolSource is what the model sees of a fetched source: its citation number
+// and the extracted passages, not the whole page.
+type toolSource struct {
+	Ref      int           `json:"ref"`
+	SourceID string        `json:"source_id"`
+	URL      string        `json:"url"`
+	Title    string        `json:"title"`
+	Snippets []toolSnippet `json:"snippets"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type toolSnippet struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// extractSnippets picks the SnippetMaxPerSource passages of every source that
+// best match focus, stores them in page_snippets and page_cache.snippets and
+// publishes a snippets.extracted step. firstRef is the citation number of
+// sources[0].
+func (s *Server) extractSnippets(ctx context.Context, runID, focus string, sources []sourceRecord, firstRef int) []toolSource {
+	limit := s.cfg.SnippetMaxPerSource
+	if limit <= 0 {
+		limit = 3
+	}
+
+	out := make([]toolSource, 0, len(sources))
+	stepItems := make([]map[string]any, 0, len(sources))
+	total := 0
+	for i, source := range sources {
+		ts := toolSource{
+			Ref:      firstRef + i,
+			SourceID: source.ID,
+			URL:      source.URL,
+			Title:    source.Title,
+			Snippets: []toolSnippet{},
+		}
+		if strings.TrimSpace(source.MarkdownContent) == "" {
+			ts.Error = "page could not be read"
+			out = append(out, ts)
+			continue
+		}
+
+		ranked := rankPassages(focus, splitPassages(source.MarkdownContent), limit)
+		snippets, err := s.storeSnippets(ctx, source, ranked)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("run_id", runID).Str("url", source.URL).Msg("store snippets failed")
+		}
+
+		quotes := make([]map[string]any, 0, len(snippets))
+		for _, snip := range snippets {
+			ts.Snippets = append(ts.Snippets, toolSnippet{ID: snip.ID, Text: snip.Quote})
+			quotes = append(quotes, map[string]any{
+				"id":    snip.ID,
+				"quote": truncateRunes(snip.Quote, 300),
+				"score": math.Round(snip.Score*100) / 100,
+			})
+		}
+		total += len(snippets)
+		out = append(out, ts)
+		stepItems = append(stepItems, map[string]any{
+			"ref":       ts.Ref,
+			"source_id": source.ID,
+			"url":       source.URL,
+			"snippets":  quotes,
+		})
+	}
+
+	s.publishStep(ctx, runID, "snippets.extracted", "Snippets extracted", map[string]any{
+		"count": total,
+		"items": stepItems,
+	})
+	return out
+}
+
+func (s *Server) storeSnippets(ctx context.Context, source sourceRecord, ranked []passage) ([]pageSnippet, error) {
+	snippets := make([]pageSnippet, 0, len(ranked))
+	quotes := make([]string, 0, len(ranked))
+	for _, p := range ranked {
+		snip := pageSnippet{Quote: p.Text, Context: p.Heading, Score: p.Score}
+		if err := s.pool.QueryRow(
+			ctx,
+			`insert into page_snippets(source_id, quote, context) values ($1,$2,$3) returning id`,
+			source.ID,
+			snip.Quote,
+			snip.Context,
+		).Scan(&snip.ID); err != nil {
+			return snippets, err
+		}
+		snippets = append(snippets, snip)
+		quotes = append(quotes, snip.Quote)
+	}
+
+	raw, err := json.Marshal(quotes)
+	if err != nil {
+		return snippets, err
+	}
+	_, err = s.pool.Exec(ctx, `update page_cache set snippets=$2 where url=$1`, source.URL, raw)
+	return snippets, err
+}
+
+// splitPassages chunks page text into passages of roughly passageTargetRunes,
+// keeping paragraphs together and remembering the closest Markdown heading.
+func splitPassages(text string) []passage {
+	var out []passage
+	var buf strings.Builder
+	heading := ""
+	bufHeading := ""
+
+	flush := func() {
+		chunk := strings.TrimSpace(buf.String())
+		buf.Reset()
+		if chunk == "" {
+			return
+		}
+		size := utf8.RuneCountInString(chunk)
+		if size < passageMinRunes && len(out) > 0 {
+			// too short to stand alone; glue it to the previous passage
+			// unless that one is already full
+			last := &out[len(out)-1]
+			if utf8.RuneCountInString(last.Text)+size <= passageMaxRunes {
+				last.Text += "\n\n" + chunk
+				return
+			}
+		}
+		out = append(out, passage{Text: chunk, Heading: bufHeading, Pos: len(out)})
+	}
+
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if strings.HasPrefix(para, "#") && !strings.Contains(para, "\n") {
+			flush()
+			heading = strings.TrimSpace(strings.TrimLeft(para, "#"))
+			continue
+		}
+		for _, piece := range splitLongParagraph(para) {
+			if buf.Len() > 0 && utf8.RuneCountInString(buf.String())+utf8.RuneCountInString(piece) > passageTargetRunes {
+				flush()
+			}
+			if buf.Len() == 0 {
+				bufHeading = heading
+			} else {
+				buf.WriteString("\n\n")
+			}
+			buf.WriteString(piece)
+		}
+	}
+	flush()
+	return out
+}
+
+// splitLongParagraph cuts a paragraph longer than passageMaxRunes at sentence
+// ends, or hard at passageMaxRunes when there are none.
+func splitLongParagraph(para string) []string {
+	if utf8.RuneCountInString(para) <= passageMaxRunes {
+		return []string{para}
+	}
+	var out []string
+	runes := []rune(para)
+	for len(runes) > passageMaxRunes {
+		cut := -1
+		for i := passageTargetRunes; i < passageMaxRunes && i < len(runes)-1; i++ {
+			if (runes[i] == '.' || runes[i] == '!' || runes[i] == '?') && unicode.IsSpace(runes[i+1]) {
+				cut = i + 1
+				break
+			}
+		}
+		if cut < 0 {
+			cut = passageMaxRunes
+		}
+		out = append(out, strings.TrimSpace(string(runes[:cut])))
+		runes = runes[cut:]
+	}
+	if rest := strings.TrimSpace(string(runes)); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+// rankPassages scores passages against query with BM25 and returns the best
+// limit of them in page order. Without any matching term the leading passages
+// are returned, which for most articles is the summary.
+func rankPassages(query string, passages []passage, limit int) []passage {
+	if len(passages) == 0 || limit <= 0 {
+		return nil
+	}
+	terms := uniqueTerms(tokenize(query))
+
+	docs := make([][]string, len(passages))
+	df := map[string]int{}
+	totalLen := 0
+	for i, p := range passages {
+		docs[i] = tokenize(p.Text + " " + p.Heading)
+		totalLen += len(docs[i])
+		seen := map[string]struct{}{}
+		for _, tok := range docs[i] {
+			if _, ok := seen[tok]; ok {
+				continue
+			}
+			seen[tok] = struct{}{}
+			df[tok]++
+		}
+	}
+	avgLen := float64(totalLen) / float64(len(passages))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+	n := float64(len(passages))
+
+	scored := make([]passage, len(passages))
+	for i, doc := range docs {
+		tf := map[string]int{}
+		for _, tok := range doc {
+			tf[tok]++
+		}
+		score := 0.0
+		for _, term := range terms {
+			f := float64(tf[term])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[term])+0.5)/(float64(df[term])+0.5))
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(len(doc))/avgLen))
+		}
+		scored[i] = passages[i]
+		scored[i].Score = score
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	if limit > len(scored) {
+		limit = len(scored)
+	}
+	top := scored[:limit]
+	sort.Slice(top, func(i, j int) bool { return top[i].Pos < top[j].Pos })
+	return top
+}
+
+// tokenize lowercases text and splits it into letter/digit runs, dropping
+// single characters. It works for any script, including Cyrillic.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if utf8.RuneCountInString(f) > 1 {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := map[string]struct{}{}
+	out := make([]string, 0, len(tokens))
+	for _, tok := range tokens {
+		if _, ok := seen[tok]; ok {
+			continue
+		}
+		seen[tok] = struct{}{}
+		out = append(out, tok)
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// space is a collection of chats with shared research settings. Empty
+// fields fall back to the server configuration.
+type space struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Instructions   string   `json:"instructions"`
+	DefaultModel   string   `json:"default_model"`
+	SearchProvider string   `json:"search_provider"`
+	SearchCategory string   `json:"search_category"`
+	AllowDomains   []string `json:"allow_domains"`
+	DenyDomains    []string `json:"deny_domains"`
+}
+
+const spaceColumns = `s.id, s.name, s.instructions, s.default_model, s.search_provider, s.search_category, s.allow_domains, s.deny_domains`
+
+func scanSpace(row pgx.Row, sp *space, extra ...any) error {
+	return row.Scan(append([]any{&sp.ID, &sp.Name, &sp.Instructions, &sp.DefaultModel, &sp.SearchProvider, &sp.SearchCategory, &sp.AllowDomains, &sp.DenyDomains}, extra...)...)
+}
+
+// loadRunSpace returns the space of the run's chat, or nil when the chat is
+// not in one.
+func (s *Server) loadRunSpace(ctx context.Context, runID string) (*space, error) {
+	var sp space
+	err := scanSpace(s.pool.QueryRow(
+		ctx,
+		`select `+spaceColumns+`
+		 from runs r
+		 join chats c on c.id=r.chat_id
+		 join spaces s on s.id=c.space_id
+		 where r.id=$1`,
+		runID,
+	), &sp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+// allowsURL applies the space's domain lists: a denied domain always loses,
+// and a non-empty allow list admits only its domains and their subdomains.
+func (sp *space) allowsURL(raw string) bool {
+	if sp == nil || (len(sp.AllowDomains) == 0 && len(sp.DenyDomains) == 0) {
+		return true
+	}
+	host := strings.TrimPrefix(strings.ToLower(domainFromURL(raw)), "www.")
+	if host == "" {
+		return false
+	}
+	if matchesDomain(host, sp.DenyDomains) {
+		return false
+	}
+	return len(sp.AllowDomains) == 0 || matchesDomain(host, sp.AllowDomains)
+}
+
+type fetchSpaceKey struct{}
+
+// withFetchSpace makes page fetches under ctx follow the space's domain
+// lists on every redirect hop, not only for the URL the agent asked for.
+func withFetchSpace(ctx context.Context, sp *space) context.Context {
+	if sp == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, fetchSpaceKey{}, sp)
+}
+
+func fetchSpaceFrom(ctx context.Context) *space {
+	sp, _ := ctx.Value(fetchSpaceKey{}).(*space)
+	return sp
+}
+
+func (sp *space) searchProviderName() string {
+	if sp == nil {
+		return ""
+	}
+	return sp.SearchProvider
+}
+
+// promptInstructions is appended to the run's system prompt: the space's
+// own instructions and, so the agent does not waste calls, its domain lists.
+func (sp *space) promptInstructions() string {
+	if sp == nil {
+		return ""
+	}
+	var b strings.Builder
+	if len(sp.AllowDomains) > 0 {
+		b.WriteString("\n- Only pages on these domains can be read: " + strings.Join(sp.AllowDomains, ", ") + ".")
+	}
+	if len(sp.DenyDomains) > 0 {
+		b.WriteString("\n- Pages on these domains are excluded: " + strings.Join(sp.DenyDomains, ", ") + ".")
+	}
+	if text := strings.TrimSpace(sp.Instructions); text != "" {
+		b.WriteString("\n" + text)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\nInstructions for this space (" + sp.Name + "):" + b.String()
+}
+
+// spaceDefaultModel is the default model of the space a run belongs to: the
+// chat's space, or spaceID for a chat about to be created.
+func (s *Server) spaceDefaultModel(ctx context.Context, userID, chatID, spaceID string) string {
+	var model string
+	if chatID != "" {
+		_ = s.pool.QueryRow(
+			ctx,
+			`select coalesce(s.default_model, '') from chats c left join spaces s on s.id=c.space_id where c.id=$1 and c.user_id=$2`,
+			chatID,
+			userID,
+		).Scan(&model)
+	} else if spaceID != "" {
+		_ = s.pool.QueryRow(ctx, `select default_model from spaces where id=$1 and user_id=$2`, spaceID, userID).Scan(&model)
+	}
+	return model
+}
+
+func (s *Server) userOwnsSpace(ctx context.Context, userID, spaceID string) (bool, error) {
+	var ok bool
+	err := s.pool.QueryRow(ctx, `select exists(select 1 from spaces where id=$1 and user_id=$2)`, spaceID, userID).Scan(&ok)
+	return ok, err
+}
+
+// validate normalizes the settings and checks them against the config.
+func (sp *space) validate(s *Server) error {
+	sp.Name = strings.TrimSpace(sp.Name)
+	if sp.Name == "" {
+		return errors.New("name is required")
+	}
+	sp.Instructions = strings.TrimSpace(sp.Instructions)
+	sp.DefaultModel = strings.TrimSpace(sp.DefaultModel)
+	if sp.DefaultModel != "" {
+		if _, ok := s.cfg.Model(sp.DefaultModel); !ok {
+			return fmt.Errorf("unknown model %q", sp.DefaultModel)
+		}
+	}
+	sp.SearchProvider = strings.ToLower(strings.TrimSpace(sp.SearchProvider))
+	if sp.SearchProvider != "" {
+		if _, ok := lookupSearchProvider(sp.SearchProvider); !ok {
+			return fmt.Errorf("unknown search provider %q (available: %s)", sp.SearchProvider, strings.Join(searchProviderNames(), ", "))
+		}
+	}
+	sp.SearchCategory = strings.ToLower(strings.TrimSpace(sp.SearchCategory))
+	if sp.SearchCategory != "" && !slices.Contains(searchCategories, sp.SearchCategory) {
+		return fmt.Errorf("unsupported search category %q (use one of %s)", sp.SearchCategory, strings.Join(searchCategories, ", "))
+	}
+	var err error
+	if sp.AllowDomains, err = normalizeDomains(sp.AllowDomains); err != nil {
+		return err
+	}
+	if sp.DenyDomains, err = normalizeDomains(sp.DenyDomains); err != nil {
+		return err
+	}
+	return nil
+}
+
+// normalizeDomains accepts bare domains or URLs and returns lowercase host
+// names without a www. prefix.
+func normalizeDomains(raw []string) ([]string, error) {
+	out := make([]string, 0, len(raw))
+	for _, entry := range raw {
+		d := strings.ToLower(strings.TrimSpace(entry))
+		if d == "" {
+			continue
+		}
+		if strings.Contains(d, "://") {
+			if parsed, err := url.Parse(d); err == nil {
+				d = parsed.Hostname()
+			}
+		}
+		d = strings.TrimPrefix(strings.Trim(d, "/. "), "www.")
+		if d == "" || strings.ContainsAny(d, " /:") {
+			return nil, fmt.Errorf("invalid domain %q", entry)
+		}
+		if !slices.Contains(out, d) {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// degraded reasons recorded on runs that ended without a final_answer call
+	degradedMaxIterations = "max_iterations"
+	degradedBudget        = "budget_exceeded"
+
+	extractiveMaxItems     = 8
+	extractivePerSource    = 2
+	extractiveSnippetRunes = 400
+)
+
+var degradedPrompts = map[string]string{
+	degradedMaxIterations: "the research step limit is reached",
+	degradedBudget:        "the budget for this run is used up",
+}
+
+// synthesizeAnswer ends a run that stopped before final_answer: it forces one
+// more final_answer call over the conversation and, when that fails too,
+// falls back to an extractive summary of the snippets in evidence.
+func (s *Server) synthesizeAnswer(ctx context.Context, runID, query string, chain *modelChain, w *contextWindow, tools []map[string]any, evidence []toolSource, reason string) (string, error) {
+	answer, err := s.forceFinalAnswer(ctx, runID, chain, w, tools, degradedPrompts[reason])
+	if err == nil {
+		s.publishStep(ctx, runID, "answer.synthesized", "Answer synthesized", map[string]any{
+			"reason": reason,
+			"mode":   "forced",
+		})
+		return answer, nil
+	}
+	if ctx.Err() != nil {
+		return "", err
+	}
+	s.logger.Warn().Err(err).Str("run_id", runID).Str("reason", reason).Msg("forced answer failed")
+
+	answer, items := extractiveAnswer(evidence)
+	mode := "extractive"
+	if items == 0 {
+		answer = fallbackAnswerSimple(query)
+		mode = "empty"
+	}
+	s.publishStep(ctx, runID, "answer.synthesized", "Answer synthesized", map[string]any{
+		"reason": reason,
+		"mode":   mode,
+		"items":  items,
+		"error":  err.Error(),
+	})
+	return answer, nil
+}
+
+// forceFinalAnswer withdraws every tool but final_answer and requires the
+// model to call it, so the answer is written from the evidence already in
+// the conversation.
+func (s *Server) forceFinalAnswer(ctx context.Context, runID string, chain *modelChain, w *contextWindow, tools []map[string]any, reason string) (string, error) {
+	final := make([]map[string]any, 0, 1)
+	for _, tool := range tools {
+		if fn, ok := tool["function"].(map[string]any); ok && fn["name"] == "final_answer" {
+			final = append(final, tool)
+		}
+	}
+	w.messages = append(w.messages, map[string]any{
+		"role": "user",
+		"content": "Stop researching: " + reason + ". Call final_answer now with the best answer the sources gathered so far support, " +
+			"citing them as [n]. Say plainly which parts of the question they do not answer.",
+	})
+
+	resp, err := s.chatWithFallback(ctx, runID, chain, w, final, map[string]any{
+		"type":     "function",
+		"function": map[string]any{"name": "final_answer"},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, call := range resp.ToolCalls {
+		if call.Function.Name != "final_answer" {
+			continue
+		}
+		var payload struct {
+			Answer string `json:"answer"`
+		}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &payload); err == nil && strings.TrimSpace(payload.Answer) != "" {
+			return strings.TrimSpace(payload.Answer), nil
+		}
+	}
+	if content := strings.TrimSpace(resp.Content); content != "" {
+		return content, nil
+	}
+	if resp.Streamed {
+		s.publishAnswerReset(runID)
+	}
+	return "", errors.New("model did not produce a final answer")
+}
+
+// extractiveAnswer lists the leading snippets of each source with their
+// citation refs. It returns the number of quoted snippets.
+func extractiveAnswer(evidence []toolSource) (string, int) {
+	var b strings.Builder
+	b.WriteString("The research did not finish, so this is a summary of the most relevant passages found rather than a written answer.\n\n")
+	items := 0
+	for _, source := range evidence {
+		for i, snip := range source.Snippets {
+			if i == extractivePerSource || items == extractiveMaxItems {
+				break
+			}
+			text := normalizeWhitespace(snip.Text)
+			if text == "" {
+				continue
+			}
+			if short := truncateRunes(text, extractiveSnippetRunes); short != text {
+				text = strings.TrimSpace(short) + "…"
+			}
+			fmt.Fprintf(&b, "- %s [%d]\n", text, source.Ref)
+			items++
+		}
+	}
+	return strings.TrimSpace(b.String()), items
+}
@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+)
+
+// trashPurgeBatch bounds how many chats one delete statement removes, so a
+// large backlog does not hold locks on runs and steps for long.
+const trashPurgeBatch = 100
+
+// RunTrashPurge hard-deletes chats that have been in the trash longer than
+// TrashRetention until ctx is done. Runs, steps, sources and the rest go with
+// them through ON DELETE CASCADE; llm_calls and run_starts are not tied to
+// runs and stay, so purging does not reset usage or quotas.
+func (s *Server) RunTrashPurge(ctx context.Context) {
+	if s.cfg.TrashRetention <= 0 || s.cfg.TrashPurgeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.TrashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		s.purgeTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) purgeTrash(ctx context.Context) {
+	cutoff := time.Now().Add(-s.cfg.TrashRetention)
+	var purged int64
+	for ctx.Err() == nil {
+		tag, err := s.pool.Exec(
+			ctx,
+			`delete from chats where id in (
+				select c.id from chats c
+				where c.deleted_at < $1
+					and not exists(select 1 from runs r where r.chat_id=c.id and r.status in ('queued','running'))
+				order by c.deleted_at
+				limit $2
+			)`,
+			cutoff,
+			trashPurgeBatch,
+		)
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("purge trash failed")
+			return
+		}
+		purged += tag.RowsAffected()
+		if tag.RowsAffected() < trashPurgeBatch {
+			break
+		}
+	}
+	if purged > 0 {
+		s.logger.Info().Int64("chats", purged).Time("cutoff", cutoff).Msg("trash purged")
+	}
+}
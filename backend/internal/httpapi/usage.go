@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// llmUsage is the OpenAI-style usage block. OpenRouter adds the cost in
+// credits (USD); other providers leave it at zero.
+type llmUsage struct {
+	PromptTokens        int     `json:"prompt_tokens"`
+	CompletionTokens    int     `json:"completion_tokens"`
+	TotalTokens         int     `json:"total_tokens"`
+	Cost                float64 `json:"cost"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+// usageTotals are summed token counts and cost, per run, model or user.
+type usageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// estimateUsage stands in for providers that do not report usage, such as
+// local servers without stream_options support.
+func estimateUsage(messages []map[string]any, out toolStepResponse) llmUsage {
+	var u llmUsage
+	for _, msg := range messages {
+		u.PromptTokens += estimateJSONTokens(msg) + messageOverheadTokens
+	}
+	u.CompletionTokens = estimateTokens(out.Content) + estimateJSONTokens(out.ToolCalls) + estimateTokens(out.Reasoning)
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+// recordLLMCall stores one completion in llm_calls, adds it to the run's
+// totals and publishes a usage step with both.
+func (s *Server) recordLLMCall(ctx context.Context, runID, model, provider string, u llmUsage, estimated bool, latency time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("record llm call failed")
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into llm_calls(run_id, user_id, model, provider, prompt_tokens, completion_tokens, reasoning_tokens, cached_tokens, total_tokens, cost, estimated, latency_ms)
+		 select $1, user_id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11 from runs where id=$1`,
+		runID,
+		model,
+		provider,
+		u.PromptTokens,
+		u.CompletionTokens,
+		u.CompletionTokensDetails.ReasoningTokens,
+		u.PromptTokensDetails.CachedTokens,
+		u.TotalTokens,
+		u.Cost,
+		estimated,
+		latency.Milliseconds(),
+	)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("record llm call failed")
+		return
+	}
+
+	var run usageTotals
+	err = tx.QueryRow(
+		ctx,
+		`update runs set
+			prompt_tokens=prompt_tokens+$2,
+			completion_tokens=completion_tokens+$3,
+			reasoning_tokens=reasoning_tokens+$4,
+			total_tokens=total_tokens+$5,
+			cost=cost+$6
+		 where id=$1
+		 returning prompt_tokens, completion_tokens, reasoning_tokens, total_tokens, cost,
+			(select count(*) from llm_calls where run_id=$1)`,
+		runID,
+		u.PromptTokens,
+		u.CompletionTokens,
+		u.CompletionTokensDetails.ReasoningTokens,
+		u.TotalTokens,
+		u.Cost,
+	).Scan(&run.PromptTokens, &run.CompletionTokens, &run.ReasoningTokens, &run.TotalTokens, &run.Cost, &run.Calls)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("update run usage failed")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		s.logger.Warn().Err(err).Str("run_id", runID).Msg("record llm call failed")
+		return
+	}
+
+	s.publishStep(ctx, runID, "usage", "Tokens used", map[string]any{
+		"model":             model,
+		"provider":          provider,
+		"prompt_tokens":     u.PromptTokens,
+		"completion_tokens": u.CompletionTokens,
+		"reasoning_tokens":  u.CompletionTokensDetails.ReasoningTokens,
+		"total_tokens":      u.TotalTokens,
+		"cost":              roundCost(u.Cost),
+		"estimated":         estimated,
+		"latency_ms":        latency.Milliseconds(),
+		"run":               run.rounded(),
+	})
+}
+
+func (t usageTotals) rounded() usageTotals {
+	t.Cost = roundCost(t.Cost)
+	return t
+}
+
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e8) / 1e8
+}